@@ -0,0 +1,112 @@
+package ghttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ResponseCache stores responses of GET requests, which are revalidated with
+// the server using the ETag and Last-Modified validators.
+type ResponseCache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+}
+
+// CachedResponse is a response stored in a ResponseCache.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ETag returns the ETag validator of the response.
+func (c *CachedResponse) ETag() string {
+	return c.Header.Get("ETag")
+}
+
+// LastModified returns the Last-Modified validator of the response.
+func (c *CachedResponse) LastModified() string {
+	return c.Header.Get("Last-Modified")
+}
+
+// NewMemoryCache returns a ResponseCache that keeps the responses in memory.
+func NewMemoryCache() ResponseCache {
+	return &memoryCache{}
+}
+
+type memoryCache struct {
+	m sync.Map
+}
+
+func (m *memoryCache) Get(key string) (*CachedResponse, bool) {
+	v, ok := m.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*CachedResponse), true
+}
+
+func (m *memoryCache) Set(key string, resp *CachedResponse) {
+	m.m.Store(key, resp)
+}
+
+func cacheKey(req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet {
+		return "", false
+	}
+	return req.URL.String(), true
+}
+
+// setConditionalHeaders sets If-None-Match and If-Modified-Since from the
+// cached response, unless the request already has them.
+func setConditionalHeaders(req *http.Request, cached *CachedResponse) {
+	if etag := cached.ETag(); etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.LastModified(); lastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// revalidate returns the response to use after a conditional request: on
+// 304 Not Modified the cached response is served, a new response with a
+// validator is stored in the cache.
+func revalidate(cache ResponseCache, key string, cached *CachedResponse, response *http.Response) (*http.Response, error) {
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		_ = response.Body.Close()
+		header := cached.Header.Clone()
+		// headers of the 304 response update the cached ones
+		for k, v := range response.Header {
+			header[k] = v
+		}
+		response.StatusCode = cached.StatusCode
+		response.Status = strconv.Itoa(cached.StatusCode) + " " + http.StatusText(cached.StatusCode)
+		response.Header = header
+		response.ContentLength = int64(len(cached.Body))
+		response.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		return response, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return response, nil
+	}
+	if response.Header.Get("ETag") == "" && response.Header.Get("Last-Modified") == "" {
+		return response, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	cache.Set(key, &CachedResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header.Clone(),
+		Body:       body,
+	})
+	return response, nil
+}
@@ -0,0 +1,66 @@
+package ghttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithResponseCache(t *testing.T) {
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+
+	tests := []struct {
+		name       string
+		validator  string
+		value      string
+		ifValidate string
+	}{
+		{name: "Last-Modified", validator: "Last-Modified", value: lastModified, ifValidate: "If-Modified-Since"},
+		{name: "ETag", validator: "ETag", value: `"v1"`, ifValidate: "If-None-Match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, notModified int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Header.Get(tt.ifValidate) == tt.value {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set(tt.validator, tt.value)
+				_, _ = w.Write([]byte(`{"name":"acme"}`))
+			}))
+			defer srv.Close()
+
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithResponseCache(NewMemoryCache()),
+			)
+
+			for i := 0; i < 2; i++ {
+				var reply struct {
+					Name string `json:"name"`
+				}
+				resp, err := c.Invoke(context.Background(), http.MethodGet, "/user", nil, &reply)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("request %d: StatusCode = %d, want %d", i, resp.StatusCode, http.StatusOK)
+				}
+				if reply.Name != "acme" {
+					t.Errorf("request %d: reply.Name = %q, want %q", i, reply.Name, "acme")
+				}
+			}
+
+			if requests != 2 || notModified != 1 {
+				t.Errorf("requests = %d, notModified = %d, want 2, 1", requests, notModified)
+			}
+		})
+	}
+}
@@ -1,28 +1,104 @@
 package ghttp
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nexuer/ghttp/encoding"
 )
 
 type Limiter interface {
 	Wait(ctx context.Context) error
 }
 
+// CallOption customizes a single call.
+//
+// Before a request is sent, the client runs the following pipeline:
+//
+//  1. set the default headers and join the endpoint into request.URL
+//  2. call Before of every CallOption in the order they are passed,
+//     e.g. Query, BasicAuth, BearerToken
+//  3. add the WithBaseQuery parameters the query does not set yet
+//  4. run the hooks registered with Before and CallOptions.BeforeHooks,
+//     in the order they are passed
+//
+// Hooks therefore see the final URL, query and headers, which makes them the
+// place to sign requests. After is called once the response is received,
+// before the response is checked by WithNot2xxError.
 type CallOption interface {
 	Before(request *http.Request) error
 	After(response *http.Response) error
 }
 
+// hookedCallOption is implemented by call options carrying Before hooks,
+// the client runs the hooks after all other call options.
+type hookedCallOption interface {
+	CallOption
+	// before applies the option without running its hooks.
+	before(request *http.Request) error
+	beforeHooks() []RequestFunc
+}
+
+// applyWithoutHooks applies opts in order, without running their hooks.
+func applyWithoutHooks(request *http.Request, opts []CallOption) error {
+	for _, callOpt := range opts {
+		if h, ok := callOpt.(hookedCallOption); ok {
+			if err := h.before(request); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := callOpt.Before(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectHooks returns the Before hooks of opts in order.
+func collectHooks(opts []CallOption) []RequestFunc {
+	var hooks []RequestFunc
+	for _, callOpt := range opts {
+		if h, ok := callOpt.(hookedCallOption); ok {
+			hooks = append(hooks, h.beforeHooks()...)
+		}
+	}
+	return hooks
+}
+
+func runRequestHooks(request *http.Request, hooks []RequestFunc) error {
+	for _, f := range hooks {
+		if err := f(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func Query(q any) CallOption {
 	return queryCallOption{query: q}
 }
 
+// QueryPercent is like Query but escapes spaces as "%20" instead of "+".
+func QueryPercent(q any) CallOption {
+	return queryCallOption{query: q, percent: true}
+}
+
 type queryCallOption struct {
-	query any
+	query   any
+	percent bool
 }
 
 func (q queryCallOption) Before(request *http.Request) error {
+	if q.percent {
+		return SetQueryPercent(request, q.query)
+	}
 	return SetQuery(request, q.query)
 }
 
@@ -70,6 +146,238 @@ func (b bearerTokenCallOption) After(response *http.Response) error {
 	return nil
 }
 
+// Accept sets the Accept header of the request, independent of the
+// Content-Type of the request body.
+func Accept(contentType string) CallOption {
+	return acceptCallOption{contentType}
+}
+
+type acceptCallOption struct {
+	contentType string
+}
+
+func (a acceptCallOption) Before(request *http.Request) error {
+	if a.contentType != "" {
+		request.Header.Set("Accept", a.contentType)
+	}
+	return nil
+}
+
+func (a acceptCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// RequestCodec marshals the args of Invoke with the codec registered as name,
+// e.g. "yaml", and sets the Content-Type of the request body accordingly,
+// independent of the Accept header and the client content type:
+//
+//	client.Invoke(ctx, http.MethodPost, "/config", cfg, &reply, ghttp.RequestCodec("yaml"))
+func RequestCodec(name string) CallOption {
+	return requestCodecCallOption{name: name}
+}
+
+type requestCodecCallOption struct {
+	name string
+}
+
+func (r requestCodecCallOption) codec() (encoding.Codec, string, error) {
+	codec := encoding.GetCodec(r.name)
+	contentType, ok := contentTypeOf(r.name)
+	if codec == nil || !ok {
+		return nil, "", fmt.Errorf("request: unknown codec: %s", r.name)
+	}
+	return codec, contentType, nil
+}
+
+func (r requestCodecCallOption) Before(request *http.Request) error {
+	_, contentType, err := r.codec()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	return nil
+}
+
+func (r requestCodecCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// findRequestCodec returns the last RequestCodec of opts, including the
+// options composed with NewCallOptions.
+func findRequestCodec(opts []CallOption) (rc requestCodecCallOption, ok bool) {
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case requestCodecCallOption:
+			rc, ok = o, true
+		case *CallOptions:
+			if nested, found := findRequestCodec(o.opts); found {
+				rc, ok = nested, true
+			}
+		}
+	}
+	return rc, ok
+}
+
+// AcceptLanguage sets the Accept-Language header from langs in order of
+// preference, weighting them with decreasing q-values:
+//
+//	AcceptLanguage("en-US", "en", "fr") // en-US,en;q=0.9,fr;q=0.8
+//
+// Duplicates are ignored, Before returns an error for an invalid language tag.
+func AcceptLanguage(langs ...string) CallOption {
+	return acceptLanguageCallOption{langs}
+}
+
+type acceptLanguageCallOption struct {
+	langs []string
+}
+
+func (a acceptLanguageCallOption) Before(request *http.Request) error {
+	var tags []string
+	seen := make(map[string]bool, len(a.langs))
+	for _, lang := range a.langs {
+		if !validLanguageTag(lang) {
+			return fmt.Errorf("accept language: invalid language tag %q", lang)
+		}
+		if key := strings.ToLower(lang); !seen[key] {
+			seen[key] = true
+			tags = append(tags, lang)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	// q-values have at most 3 decimals, step by 0.1 while it fits
+	step := 100
+	if len(tags) > 10 {
+		step = max(1000/len(tags), 1)
+	}
+	var buf strings.Builder
+	for i, tag := range tags {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(tag)
+		if i > 0 {
+			q := strconv.FormatFloat(float64(1000-i*step)/1000, 'f', -1, 64)
+			buf.WriteString(";q=")
+			buf.WriteString(q)
+		}
+	}
+	request.Header.Set("Accept-Language", buf.String())
+	return nil
+}
+
+func (a acceptLanguageCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// validLanguageTag reports whether tag is "*" or made of 1 to 8 alphanumeric
+// subtags separated by "-", starting with a letter, as in RFC 4647.
+func validLanguageTag(tag string) bool {
+	if tag == "*" {
+		return true
+	}
+	subtags := strings.Split(tag, "-")
+	for i, sub := range subtags {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for _, c := range sub {
+			isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			if !isAlpha && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// HostHeader sets request.Host, the Host header sent to the server, while the
+// connection is still made to the host of the URL, e.g. to test a virtual
+// host through a load balancer or a local proxy. Setting "Host" through
+// request.Header has no effect, net/http ignores it.
+func HostHeader(host string) CallOption {
+	return hostHeaderCallOption{host}
+}
+
+type hostHeaderCallOption struct {
+	host string
+}
+
+func (h hostHeaderCallOption) Before(request *http.Request) error {
+	if h.host != "" {
+		request.Host = h.host
+	}
+	return nil
+}
+
+func (h hostHeaderCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// TransformBody rewrites the marshaled request body before it is sent, e.g.
+// to wrap it in an envelope. ContentLength and GetBody are updated.
+func TransformBody(f func(contentType string, body []byte) ([]byte, error)) CallOption {
+	return transformBodyCallOption{f}
+}
+
+type transformBodyCallOption struct {
+	transform func(contentType string, body []byte) ([]byte, error)
+}
+
+func (t transformBodyCallOption) Before(request *http.Request) error {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return err
+	}
+	_ = request.Body.Close()
+	if body, err = t.transform(request.Header.Get("Content-Type"), body); err != nil {
+		return err
+	}
+	request.GetBody = nil
+	return SetRequestBody(request, bytes.NewBuffer(body))
+}
+
+func (t transformBodyCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// TransformResponse rewrites the response body before it is decoded, e.g. to
+// unwrap an envelope. It applies to both the reply and WithNot2xxError decoding.
+func TransformResponse(f func(contentType string, body []byte) ([]byte, error)) CallOption {
+	return transformResponseCallOption{f}
+}
+
+type transformResponseCallOption struct {
+	transform func(contentType string, body []byte) ([]byte, error)
+}
+
+func (t transformResponseCallOption) Before(request *http.Request) error {
+	return nil
+}
+
+func (t transformResponseCallOption) After(response *http.Response) error {
+	if response.Body == nil || response.Body == http.NoBody {
+		return nil
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if body, err = t.transform(response.Header.Get("Content-Type"), body); err != nil {
+		return err
+	}
+	response.ContentLength = int64(len(body))
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
 func Before(hooks ...RequestFunc) CallOption {
 	return beforeHooksCallOption{hooks}
 }
@@ -79,18 +387,67 @@ type beforeHooksCallOption struct {
 }
 
 func (b beforeHooksCallOption) Before(request *http.Request) error {
-	for _, f := range b.hooks {
-		if err := f(request); err != nil {
-			return err
-		}
-	}
+	return runRequestHooks(request, b.hooks)
+}
+
+func (b beforeHooksCallOption) before(request *http.Request) error {
 	return nil
 }
 
+func (b beforeHooksCallOption) beforeHooks() []RequestFunc {
+	return b.hooks
+}
+
 func (b beforeHooksCallOption) After(response *http.Response) error {
 	return nil
 }
 
+// SignQuery appends the parameter name with the signature computed by sign
+// over the final query of the request, as required by e.g. payment gateways:
+//
+//	ghttp.SignQuery("sign", func(values url.Values) (string, error) {
+//	    mac := hmac.New(sha256.New, secret)
+//	    mac.Write([]byte(values.Encode()))
+//	    return hex.EncodeToString(mac.Sum(nil)), nil
+//	})
+//
+// It runs as a Before hook, after Query and WithBaseQuery, so the signature
+// covers every parameter. values.Encode() is sorted by key, a deterministic
+// input for the signature. A parameter name already in the query is removed
+// before signing, the signature is appended without re-encoding the rest of
+// the query.
+func SignQuery(name string, sign func(values url.Values) (string, error)) CallOption {
+	return Before(func(request *http.Request) error {
+		values := request.URL.Query()
+		values.Del(name)
+		signature, err := sign(values)
+		if err != nil {
+			return err
+		}
+		params := deleteRawQuery(request.URL.RawQuery, name)
+		params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(signature))
+		request.URL.RawQuery = strings.Join(params, "&")
+		return nil
+	})
+}
+
+// deleteRawQuery splits rawQuery into its parameters, without the ones named
+// name, keeping the others as they were encoded.
+func deleteRawQuery(rawQuery, name string) []string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(param, "=")
+		if k, err := url.QueryUnescape(key); err == nil && k == name {
+			continue
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
 func After(hooks ...ResponseFunc) CallOption {
 	return afterHooksCallOption{hooks}
 }
@@ -130,15 +487,40 @@ type CallOptions struct {
 	// hooks
 	BeforeHooks []RequestFunc
 	AfterHooks  []ResponseFunc
+
+	// opts are the functional options, applied after the fields
+	opts []CallOption
 }
 
+// NewCallOptions composes functional options into CallOptions, so that they
+// can be combined with the fields:
+//
+//	opts := ghttp.NewCallOptions(ghttp.Query(q), ghttp.Accept("application/xml"))
+//	opts.BearerToken = token
+//
+// The fields are applied first, then opts in order. Likewise BeforeHooks run
+// before the hooks of opts, and AfterHooks before After of opts.
+func NewCallOptions(opts ...CallOption) *CallOptions {
+	return &CallOptions{opts: opts}
+}
+
+// Before sets the query and auth, applies the functional options, then runs
+// the hooks.
 func (c *CallOptions) Before(request *http.Request) error {
-	for _, f := range c.BeforeHooks {
-		if err := f(request); err != nil {
-			return err
-		}
+	if err := c.before(request); err != nil {
+		return err
 	}
+	return runRequestHooks(request, c.beforeHooks())
+}
+
+func (c *CallOptions) beforeHooks() []RequestFunc {
+	if len(c.opts) == 0 {
+		return c.BeforeHooks
+	}
+	return append(append([]RequestFunc(nil), c.BeforeHooks...), collectHooks(c.opts)...)
+}
 
+func (c *CallOptions) before(request *http.Request) error {
 	if err := SetQuery(request, c.Query); err != nil {
 		return err
 	}
@@ -151,7 +533,7 @@ func (c *CallOptions) Before(request *http.Request) error {
 		request.Header.Set("Authorization", "Bearer "+c.BearerToken)
 	}
 
-	return nil
+	return applyWithoutHooks(request, c.opts)
 }
 
 func (c *CallOptions) After(response *http.Response) error {
@@ -160,5 +542,10 @@ func (c *CallOptions) After(response *http.Response) error {
 			return err
 		}
 	}
+	for _, callOpt := range c.opts {
+		if err := callOpt.After(response); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -2,8 +2,17 @@ package ghttp_test
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/nexuer/ghttp"
@@ -81,3 +90,452 @@ func TestBearerToken(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBefore_FinalURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL + "/api/v4"),
+	)
+
+	var got string
+	hook := ghttp.Before(func(request *http.Request) error {
+		got = request.URL.String()
+		return nil
+	})
+
+	want := srv.URL + "/api/v4/projects?page=1"
+	_, err := client.Invoke(context.Background(), http.MethodGet, "projects", nil, nil,
+		ghttp.Query(map[string]any{"page": 1}), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Invoke() hook saw URL %q, want %q", got, want)
+	}
+
+	got = ""
+	req, err := http.NewRequest(http.MethodGet, "projects", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Do(req, ghttp.Query(map[string]any{"page": 1}), hook); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Do() hook saw URL %q, want %q", got, want)
+	}
+}
+
+func TestBefore_SigningHook(t *testing.T) {
+	var gotSig string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-Signature")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+	)
+
+	sign := func(request *http.Request) error {
+		request.Header.Set("X-Signature", request.URL.Path+"?"+request.URL.RawQuery+"&"+request.Header.Get("Authorization"))
+		return nil
+	}
+	want := "/projects?page=1&size=10&Bearer token"
+
+	tests := []struct {
+		name string
+		opts []ghttp.CallOption
+	}{
+		{
+			name: "hook passed first",
+			opts: []ghttp.CallOption{
+				ghttp.Before(sign),
+				ghttp.Query(map[string]any{"page": 1, "size": 10}),
+				ghttp.BearerToken("token"),
+			},
+		},
+		{
+			name: "CallOptions",
+			opts: []ghttp.CallOption{
+				&ghttp.CallOptions{
+					Query:       map[string]any{"page": 1, "size": 10},
+					BearerToken: "token",
+					BeforeHooks: []ghttp.RequestFunc{sign},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSig = ""
+			if _, err := client.Invoke(context.Background(), http.MethodGet, "projects", nil, nil, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			if gotSig != want {
+				t.Errorf("X-Signature = %q, want %q", gotSig, want)
+			}
+		})
+	}
+}
+
+func TestNewCallOptions(t *testing.T) {
+	type seen struct {
+		query, auth, accept, order string
+	}
+	var got seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = seen{
+			query:  r.URL.RawQuery,
+			auth:   r.Header.Get("Authorization"),
+			accept: r.Header.Get("Accept"),
+			order:  strings.Join(r.Header.Values("X-Order"), ","),
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+	)
+
+	hook := func(name string) ghttp.RequestFunc {
+		return func(request *http.Request) error {
+			request.Header.Add("X-Order", name)
+			return nil
+		}
+	}
+	var after []string
+	afterHook := func(name string) ghttp.ResponseFunc {
+		return func(response *http.Response) error {
+			after = append(after, name)
+			return nil
+		}
+	}
+
+	functional := []ghttp.CallOption{
+		ghttp.Query(map[string]any{"page": 1}),
+		ghttp.BearerToken("token"),
+		ghttp.Before(hook("a")),
+		ghttp.Accept("application/xml"),
+		ghttp.Before(hook("b")),
+		ghttp.After(afterHook("a"), afterHook("b")),
+	}
+	composed := ghttp.NewCallOptions(
+		ghttp.Accept("application/xml"),
+		ghttp.Before(hook("b")),
+		ghttp.After(afterHook("b")),
+	)
+	composed.Query = map[string]any{"page": 1}
+	composed.BearerToken = "token"
+	composed.BeforeHooks = []ghttp.RequestFunc{hook("a")}
+	composed.AfterHooks = []ghttp.ResponseFunc{afterHook("a")}
+
+	var results []seen
+	for _, opts := range [][]ghttp.CallOption{functional, {composed}} {
+		after = nil
+		if _, err := client.Invoke(context.Background(), http.MethodGet, "/", nil, nil, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(after) != "[a b]" {
+			t.Errorf("After order = %v, want [a b]", after)
+		}
+		results = append(results, got)
+	}
+
+	want := seen{query: "page=1", auth: "Bearer token", accept: "application/xml", order: "a,b"}
+	for i, r := range results {
+		if r.query != want.query || r.auth != want.auth || r.accept != want.accept || r.order != want.order {
+			t.Errorf("request %d = %+v, want %+v", i, r, want)
+		}
+	}
+}
+
+func TestAccept(t *testing.T) {
+	var gotAccept, gotContentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccept = r.Header.Get("Accept")
+		gotContentType = r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(`<user><name>acme</name></user>`))
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+	)
+
+	var reply struct {
+		Name string `xml:"name"`
+	}
+	_, err := client.Invoke(context.Background(), http.MethodPost, "users", map[string]string{"name": "acme"}, &reply,
+		ghttp.Accept("application/xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAccept != "application/xml" {
+		t.Errorf("Accept = %q, want %q", gotAccept, "application/xml")
+	}
+	if gotContentType != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", gotContentType, "application/json")
+	}
+	if reply.Name != "acme" {
+		t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	many := make([]string, 12)
+	for i := range many {
+		many[i] = fmt.Sprintf("l%c", 'a'+i)
+	}
+
+	tests := []struct {
+		name    string
+		langs   []string
+		want    string
+		wantErr bool
+	}{
+		{name: "none", langs: nil, want: ""},
+		{name: "single", langs: []string{"en-US"}, want: "en-US"},
+		{name: "multiple", langs: []string{"en-US", "en", "fr", "*"}, want: "en-US,en;q=0.9,fr;q=0.8,*;q=0.7"},
+		{name: "duplicates", langs: []string{"en", "EN", "de-CH"}, want: "en,de-CH;q=0.9"},
+		{name: "script and region", langs: []string{"zh-Hant-TW", "es-419"}, want: "zh-Hant-TW,es-419;q=0.9"},
+		{
+			name:  "more than ten",
+			langs: many,
+			want:  "la,lb;q=0.917,lc;q=0.834,ld;q=0.751,le;q=0.668,lf;q=0.585,lg;q=0.502,lh;q=0.419,li;q=0.336,lj;q=0.253,lk;q=0.17,ll;q=0.087",
+		},
+		{name: "empty", langs: []string{""}, wantErr: true},
+		{name: "q-value", langs: []string{"en;q=0.5"}, wantErr: true},
+		{name: "digit first", langs: []string{"1en"}, wantErr: true},
+		{name: "too long", langs: []string{"abcdefghi"}, wantErr: true},
+	}
+
+	client := ghttp.NewClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := client.NewRequest(context.Background(), http.MethodGet, "http://example.com", nil,
+				ghttp.AcceptLanguage(tt.langs...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRequest() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := req.Header.Get("Accept-Language"); got != tt.want {
+				t.Errorf("Accept-Language = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	var gotHost string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+	)
+
+	if _, err := client.Invoke(context.Background(), http.MethodGet, "/", nil, nil,
+		ghttp.HostHeader("api.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if gotHost != "api.example.com" {
+		t.Errorf("Host = %q, want %q", gotHost, "api.example.com")
+	}
+
+	// without the option the host of the URL is sent
+	if _, err := client.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimPrefix(srv.URL, "http://"); gotHost != want {
+		t.Errorf("Host = %q, want %q", gotHost, want)
+	}
+}
+
+func TestTransformBody(t *testing.T) {
+	var got []byte
+	var gotLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		gotLength = r.ContentLength
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+	)
+
+	envelope := ghttp.TransformBody(func(contentType string, body []byte) ([]byte, error) {
+		if contentType != "application/json" {
+			return nil, fmt.Errorf("unexpected content type %q", contentType)
+		}
+		return []byte(`{"data":` + string(body) + `}`), nil
+	})
+
+	_, err := client.Invoke(context.Background(), http.MethodPost, "users", map[string]string{"name": "acme"}, nil, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"data":{"name":"acme"}}`
+	if string(got) != want {
+		t.Errorf("server received %s, want %s", got, want)
+	}
+	if gotLength != int64(len(want)) {
+		t.Errorf("ContentLength = %d, want %d", gotLength, len(want))
+	}
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func TestTransformResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"data":{"message":"bad request"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"name":"acme"}}`))
+	}))
+	defer srv.Close()
+
+	client := ghttp.NewClient(
+		ghttp.WithEndpoint(srv.URL),
+		ghttp.WithNot2xxError(func() error {
+			return &apiError{}
+		}),
+	)
+
+	unwrap := ghttp.TransformResponse(func(contentType string, body []byte) ([]byte, error) {
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, err
+		}
+		return envelope.Data, nil
+	})
+
+	var reply struct {
+		Name string `json:"name"`
+	}
+	if _, err := client.Invoke(context.Background(), http.MethodGet, "/ok", nil, &reply, unwrap); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Name != "acme" {
+		t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+	}
+
+	_, err := client.Invoke(context.Background(), http.MethodGet, "/fail", nil, nil, unwrap)
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.Message != "bad request" {
+		t.Errorf("Invoke() error = %v, want apiError bad request", err)
+	}
+}
+
+func TestRequestCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if ct := r.Header.Get("Content-Type"); ct != "application/yaml" {
+			t.Errorf("Content-Type = %q, want application/yaml", ct)
+		}
+		if accept := r.Header.Get("Accept"); accept != "application/json" {
+			t.Errorf("Accept = %q, want application/json", accept)
+		}
+		if string(body) != "name: acme\nreplicas: 2\n" {
+			t.Errorf("body = %q", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"created"}`))
+	}))
+	defer srv.Close()
+
+	type config struct {
+		Name     string `yaml:"name"`
+		Replicas int    `yaml:"replicas"`
+	}
+	var reply struct {
+		Status string `json:"status"`
+	}
+
+	client := ghttp.NewClient(ghttp.WithEndpoint(srv.URL))
+	_, err := client.Invoke(context.Background(), http.MethodPost, "/config", config{Name: "acme", Replicas: 2}, &reply,
+		ghttp.RequestCodec("yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Status != "created" {
+		t.Errorf("Status = %q, want created", reply.Status)
+	}
+
+	_, err = client.Invoke(context.Background(), http.MethodPost, "/config", config{}, nil, ghttp.RequestCodec("unknown"))
+	if err == nil || !strings.Contains(err.Error(), "unknown codec") {
+		t.Errorf("Invoke() error = %v, want unknown codec", err)
+	}
+}
+
+func TestSignQuery(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	sign := func(values url.Values) (string, error) {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(values.Encode()))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+
+	client := ghttp.NewClient(ghttp.WithEndpoint(srv.URL), ghttp.WithBaseQuery(url.Values{"app_id": {"42"}}))
+	_, err := client.Invoke(context.Background(), http.MethodGet, "/pay", nil, nil,
+		ghttp.SignQuery("sign", sign),
+		ghttp.Query(map[string]string{"order": "A1", "amount": "9.90"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HMAC-SHA256("secret", "amount=9.90&app_id=42&order=A1")
+	want := "amount=9.90&order=A1&app_id=42&sign=86b24685e9f174aa2e528718c838166521154740dbd40d46d71561eff6c03acb"
+	if gotQuery != want {
+		t.Errorf("RawQuery = %q, want %q", gotQuery, want)
+	}
+
+	// a stale signature is neither signed nor sent
+	_, err = client.Invoke(context.Background(), http.MethodGet, "/pay", nil, nil,
+		ghttp.SignQuery("sign", sign),
+		ghttp.Query(map[string]string{"order": "A1", "amount": "9.90", "sign": "stale"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotQuery != want {
+		t.Errorf("RawQuery = %q, want %q", gotQuery, want)
+	}
+
+	errSign := errors.New("sign")
+	_, err = client.Invoke(context.Background(), http.MethodGet, "/pay", nil, nil,
+		ghttp.SignQuery("sign", func(url.Values) (string, error) { return "", errSign }))
+	if !errors.Is(err, errSign) {
+		t.Errorf("Invoke() error = %v, want %v", err, errSign)
+	}
+}
@@ -1,14 +1,22 @@
 package ghttp
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/nexuer/ghttp/encoding"
 	"golang.org/x/time/rate"
 )
 
@@ -111,3 +119,624 @@ func TestTextPlain(t *testing.T) {
 	}
 
 }
+
+func TestWithErrorDecoder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/fail" {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"invalid token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	type result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithErrorDecoder(func(resp *http.Response) error {
+			var r result
+			if err := BindResponseBody(resp, &r); err != nil {
+				return err
+			}
+			if !r.OK {
+				return fmt.Errorf("api: %s", r.Error)
+			}
+			return nil
+		}),
+	)
+
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/fail", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "api: invalid token") {
+		t.Fatalf("Invoke() error = %v, want api: invalid token", err)
+	}
+	if code, ok := StatusForErr(err); !ok || code != http.StatusOK {
+		t.Errorf("StatusForErr() = %d, %t, want %d, true", code, ok, http.StatusOK)
+	}
+
+	var reply result
+	if _, err = c.Invoke(context.Background(), http.MethodGet, "/ok", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reply.OK {
+		t.Errorf("reply.OK = false, want true")
+	}
+}
+
+func TestWithStrictCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}))
+	defer srv.Close()
+
+	not2xx := WithNot2xxError(func() error { return &gitlabErr{} })
+
+	// the html page is decoded as json
+	_, err := NewClient(WithEndpoint(srv.URL), not2xx).
+		Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid character") {
+		t.Fatalf("Invoke() error = %v, want a json error", err)
+	}
+
+	_, err = NewClient(WithEndpoint(srv.URL), WithStrictCodec(true), not2xx).
+		Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported content type: text/html") {
+		t.Fatalf("Invoke() error = %v, want unsupported content type", err)
+	}
+	if code, ok := StatusForErr(err); !ok || code != http.StatusBadGateway {
+		t.Errorf("StatusForErr() = %d, %t, want %d, true", code, ok, http.StatusBadGateway)
+	}
+
+	var reply gitlabErr
+	_, err = NewClient(WithEndpoint(srv.URL), WithStrictCodec(true), WithSuccessPredicate(func(int) bool { return true })).
+		Invoke(context.Background(), http.MethodGet, "/", nil, &reply)
+	if err == nil || !strings.Contains(err.Error(), "unsupported content type: text/html") {
+		t.Fatalf("Invoke() error = %v, want unsupported content type", err)
+	}
+}
+
+func TestWithSuccessPredicate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/not-modified" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"message":"created only"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		predicate func(code int) bool
+		wantErr   bool
+	}{
+		{
+			name:      "default 304",
+			path:      "/not-modified",
+			predicate: nil,
+			wantErr:   true,
+		},
+		{
+			name: "304 as success",
+			path: "/not-modified",
+			predicate: func(code int) bool {
+				return code == http.StatusNotModified || !not2xxCode(code)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "default 200",
+			path:      "/",
+			predicate: nil,
+			wantErr:   false,
+		},
+		{
+			name: "200 as failure",
+			path: "/",
+			predicate: func(code int) bool {
+				return code == http.StatusCreated
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []ClientOption{
+				WithEndpoint(srv.URL),
+				WithNot2xxError(func() error {
+					return &gitlabErr{}
+				}),
+			}
+			if tt.predicate != nil {
+				opts = append(opts, WithSuccessPredicate(tt.predicate))
+			}
+			c := NewClient(opts...)
+			_, err := c.Invoke(context.Background(), http.MethodGet, tt.path, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Invoke() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithDebugWriter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugWriter(&buf),
+	)
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"> GET ", "< HTTP/1.1 200 OK", `"name": "acme"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestInvoke_GetWithBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	var getBody bool
+	c := NewClient(WithEndpoint(srv.URL))
+
+	args := map[string]any{"query": map[string]any{"match_all": map[string]any{}}}
+	var reply map[string]any
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/_search", args, &reply,
+		Before(func(request *http.Request) error {
+			getBody = request.GetBody != nil
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !getBody {
+		t.Errorf("request GetBody is nil, want rewindable body")
+	}
+	if _, ok := reply["query"]; !ok {
+		t.Errorf("reply = %v, want the echoed body", reply)
+	}
+}
+
+func TestClient_NewRequest(t *testing.T) {
+	c := NewClient(
+		WithEndpoint("https://example.com/api/v4"),
+		WithUserAgent("ghttp-test"),
+	)
+
+	req, err := c.NewRequest(context.Background(), http.MethodPost, "projects", map[string]string{"name": "acme"},
+		Query(map[string]any{"page": 1}), BearerToken("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "https://example.com/api/v4/projects?page=1"; req.URL.String() != want {
+		t.Errorf("URL = %q, want %q", req.URL.String(), want)
+	}
+	for k, want := range map[string]string{
+		"User-Agent":    "ghttp-test",
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer token",
+	} {
+		if got := req.Header.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"acme"}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
+
+func TestWithUserInfoAuth(t *testing.T) {
+	var username, password string
+	var hasAuth bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, hasAuth = r.BasicAuth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	endpoint := strings.Replace(srv.URL, "http://", "http://user:p%40ss@", 1)
+	c := NewClient(
+		WithEndpoint(endpoint),
+		WithUserInfoAuth(),
+	)
+
+	var gotURL string
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/api", nil, nil,
+		Before(func(request *http.Request) error {
+			gotURL = request.URL.String()
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasAuth || username != "user" || password != "p@ss" {
+		t.Errorf("BasicAuth() = %q, %q, %t, want user, p@ss, true", username, password, hasAuth)
+	}
+	if want := srv.URL + "/api"; gotURL != want {
+		t.Errorf("URL = %q, want %q", gotURL, want)
+	}
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.UserAgent()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	pattern := regexp.MustCompile(`^ghttp/` + regexp.QuoteMeta(Version) + ` \(go[^)]+\)$`)
+
+	if _, err := NewClient(WithEndpoint(srv.URL)).Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !pattern.MatchString(got) {
+		t.Errorf("User-Agent = %q, want match %s", got, pattern)
+	}
+
+	c := NewClient(WithEndpoint(srv.URL), WithUserAgent("sdk/1.0"))
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != "sdk/1.0" {
+		t.Errorf("User-Agent = %q, want %q", got, "sdk/1.0")
+	}
+}
+
+func TestWithTimeoutAfterLimiter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		after   bool
+		wantErr bool
+	}{
+		{after: false, wantErr: true},
+		{after: true, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("after=%t", tt.after), func(t *testing.T) {
+			// the second request waits 200ms for the limiter, longer than the timeout
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithTimeout(150*time.Millisecond),
+				WithLimiter(rate.NewLimiter(rate.Every(200*time.Millisecond), 1)),
+				WithTimeoutAfterLimiter(tt.after),
+			)
+			if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Invoke() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && !IsTimeout(err) {
+				t.Errorf("IsTimeout(%v) = false, want true", err)
+			}
+		})
+	}
+}
+
+func TestInvoke_Trailer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL))
+
+	// the body is read by Invoke
+	var reply struct {
+		Name string `json:"name"`
+	}
+	resp, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Trailer Grpc-Status = %q, want %q", got, "0")
+	}
+
+	// the body is read by the caller
+	resp, err = c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Trailer.Get("Grpc-Status"); got != "" {
+		t.Errorf("Trailer Grpc-Status before reading the body = %q, want empty", got)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Trailer Grpc-Status = %q, want %q", got, "0")
+	}
+}
+
+func TestInvoke_TrailerLargeBody(t *testing.T) {
+	// larger than the transport buffers, the body is still being received
+	// when Invoke returns
+	payload := bytes.Repeat([]byte("x"), 4<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write(payload)
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(5*time.Second))
+	resp, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the body after Invoke: %v", err)
+	}
+	if len(body) != len(payload) {
+		t.Errorf("body has %d bytes, want %d", len(body), len(payload))
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Trailer Grpc-Status = %q, want %q", got, "0")
+	}
+
+	// closing the body releases the timeout
+	_ = resp.Body.Close()
+	if err = resp.Request.Context().Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("request context error after Close = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWithBaseQuery(t *testing.T) {
+	c := NewClient(
+		WithEndpoint("http://example.com/api"),
+		WithBaseQuery(map[string]any{"api_version": 2, "lang": "en"}),
+	)
+
+	tests := []struct {
+		name string
+		path string
+		opts []CallOption
+		want string
+	}{
+		{name: "base only", path: "/users", want: "api_version=2&lang=en"},
+		{name: "call query", path: "/users", opts: []CallOption{Query(map[string]any{"page": 1})}, want: "page=1&api_version=2&lang=en"},
+		{name: "call override", path: "/users", opts: []CallOption{Query(map[string]any{"api_version": 3})}, want: "api_version=3&lang=en"},
+		{name: "path override", path: "/users?lang=fr", want: "lang=fr&api_version=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signed string
+			opts := append(tt.opts, Before(func(request *http.Request) error {
+				signed = request.URL.RawQuery
+				return nil
+			}))
+			req, err := c.NewRequest(context.Background(), http.MethodGet, tt.path, nil, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.URL.RawQuery != tt.want {
+				t.Errorf("RawQuery = %q, want %q", req.URL.RawQuery, tt.want)
+			}
+			// hooks see the base query
+			if signed != tt.want {
+				t.Errorf("hook saw RawQuery = %q, want %q", signed, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRequestInterceptor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithRequestInterceptor(func(method, path string, args any) (any, error) {
+			if path == "/fail" {
+				return nil, errors.New("interceptor: denied")
+			}
+			if m, ok := args.(map[string]any); ok && strings.HasPrefix(path, "/admin/") {
+				m["scope"] = "admin"
+			}
+			return args, nil
+		}),
+	)
+
+	tests := []struct {
+		path string
+		want map[string]any
+	}{
+		{path: "/users", want: map[string]any{"name": "acme"}},
+		{path: "/admin/users", want: map[string]any{"name": "acme", "scope": "admin"}},
+	}
+	for _, tt := range tests {
+		var reply map[string]any
+		if _, err := c.Invoke(context.Background(), http.MethodPost, tt.path, map[string]any{"name": "acme"}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(reply, tt.want) {
+			t.Errorf("Invoke(%q) reply = %v, want %v", tt.path, reply, tt.want)
+		}
+	}
+
+	if _, err := c.Invoke(context.Background(), http.MethodPost, "/fail", nil, nil); err == nil || err.Error() != "interceptor: denied" {
+		t.Errorf("Invoke() error = %v, want interceptor: denied", err)
+	}
+}
+
+func TestClient_Options(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			t.Errorf("Content-Type = %q, want none", ct)
+		}
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL))
+	header, err := c.Options(context.Background(), "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("Allow"); got != "GET, POST, OPTIONS" {
+		t.Errorf("Allow = %q, want %q", got, "GET, POST, OPTIONS")
+	}
+	if got := header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestWithDecodeFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a json body labeled as xml
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	type user struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	var reply user
+	_, err := NewClient(WithEndpoint(srv.URL)).Invoke(context.Background(), http.MethodGet, "/", nil, &reply)
+	if err == nil {
+		t.Fatal("Invoke() without fallback: want error")
+	}
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDecodeFallback(encoding.GetCodec("xml"), encoding.GetCodec("json")),
+	)
+	reply = user{}
+	if _, err = c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Name != "acme" {
+		t.Errorf("Name = %q, want acme", reply.Name)
+	}
+
+	// the error of the content type codec is returned when all fail
+	c = NewClient(WithEndpoint(srv.URL), WithDecodeFallback(encoding.GetCodec("yaml")))
+	var s []int
+	_, err = c.Invoke(context.Background(), http.MethodGet, "/", nil, &s)
+	if err == nil || !strings.Contains(err.Error(), "EOF") {
+		t.Errorf("Invoke() error = %v, want the xml error", err)
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}))
+	defer srv.Close()
+
+	var captured []string
+	c := NewClient(
+		WithEndpoint(srv.URL+"/api"),
+		WithDryRun(func(req *http.Request) {
+			var body []byte
+			if req.Body != nil {
+				body, _ = io.ReadAll(req.Body)
+			}
+			captured = append(captured, fmt.Sprintf("%s %s %s %s", req.Method, req.URL.RequestURI(), req.Header.Get("Authorization"), body))
+		}),
+	)
+
+	type user struct {
+		Name string `json:"name"`
+	}
+	reply := user{Name: "unchanged"}
+	response, err := c.Invoke(context.Background(), http.MethodPost, "/users", user{Name: "acme"}, &reply,
+		BearerToken("token"), Query(map[string]any{"page": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if reply.Name != "unchanged" {
+		t.Errorf("reply = %+v, want unchanged", reply)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/users/1", nil)
+	if _, err = c.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`POST /api/users?page=1 Bearer token {"name":"acme"}`,
+		"DELETE /api/users/1  ",
+	}
+	if !reflect.DeepEqual(captured, want) {
+		t.Errorf("captured = %q, want %q", captured, want)
+	}
+
+	// the body is closed once f returns, like a file body by the transport
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err = os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var body io.ReadCloser
+	dry := NewClient(WithDryRun(func(req *http.Request) {
+		body = req.Body
+	}))
+	if _, err = dry.Invoke(context.Background(), http.MethodPut, srv.URL+"/upload", nil, nil, FileBody(path)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = body.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Read() of the file body error = %v, want %v", err, os.ErrClosed)
+	}
+}
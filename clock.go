@@ -0,0 +1,110 @@
+package ghttp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// clock is the source of time for timeouts and retry backoff, replaced in
+// tests with withClock.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// withTimeout is context.WithTimeout measured with clk.
+func withTimeout(parent context.Context, clk clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clk.(systemClock); ok {
+		return context.WithTimeout(parent, d)
+	}
+
+	ctx := &clockContext{
+		Context:  parent,
+		deadline: clk.Now().Add(d),
+		done:     make(chan struct{}),
+	}
+	stop := make(chan struct{})
+	timer := clk.After(d)
+	go func() {
+		select {
+		case <-parent.Done():
+			ctx.finish(parent.Err())
+		case <-timer:
+			ctx.finish(context.DeadlineExceeded)
+		case <-stop:
+			ctx.finish(context.Canceled)
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// clockContext is a context with a deadline measured by a clock.
+type clockContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *clockContext) finish(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *clockContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// sleep waits for d measured with clk, or until ctx is done.
+func sleep(ctx context.Context, clk clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	if _, ok := clk.(systemClock); ok {
+		// time.After can't be stopped, keep the timer from outliving
+		// a canceled sleep.
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clk.After(d):
+		return nil
+	}
+}
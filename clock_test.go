@@ -0,0 +1,165 @@
+package ghttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves with Advance.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing the timers that are due.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = waiters
+}
+
+// waitTimers blocks until n timers are pending.
+func (f *fakeClock) waitTimers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		pending := len(f.waiters)
+		f.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d timers", n)
+}
+
+func TestClock_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	clk := newFakeClock()
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(time.Hour), withClock(clk))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+		errc <- err
+	}()
+
+	clk.waitTimers(t, 1)
+	select {
+	case err := <-errc:
+		t.Fatalf("Invoke() returned before the timeout: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clk.Advance(time.Hour)
+	select {
+	case err := <-errc:
+		if !IsTimeout(err) {
+			t.Errorf("Invoke() error = %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Invoke() did not time out")
+	}
+}
+
+func TestClock_RetryBackoff(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	clk := newFakeClock()
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(time.Hour), WithRetry(3, time.Minute), withClock(clk))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+		errc <- err
+	}()
+
+	// one timer for the client timeout, one for the backoff
+	for i := 0; i < 2; i++ {
+		clk.waitTimers(t, 2)
+		clk.Advance(time.Minute)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Invoke() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Invoke() did not return")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server called %d times, want 3", got)
+	}
+}
+
+func TestSleep_SystemClockCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleep(ctx, systemClock{}, time.Hour); err != context.Canceled {
+		t.Fatalf("sleep() error = %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("sleep() returned after %v", d)
+	}
+
+	if err := sleep(context.Background(), systemClock{}, time.Millisecond); err != nil {
+		t.Errorf("sleep() error = %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package ghttp
 
 import (
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/nexuer/ghttp/encoding"
+	"github.com/nexuer/ghttp/encoding/binary"
 	"github.com/nexuer/ghttp/encoding/json"
 	"github.com/nexuer/ghttp/encoding/plain"
 	"github.com/nexuer/ghttp/encoding/proto"
@@ -23,12 +26,16 @@ var defaultContentType = &contentType{
 		"x-yaml":     yaml.Name,
 		"yaml":       yaml.Name,
 		"plain":      plain.Name,
+
+		"octet-stream": binary.Name,
 	},
+	fallback: []string{"*"},
 }
 
 type contentType struct {
-	subType map[string]string
-	mu      sync.RWMutex
+	subType  map[string]string
+	fallback []string
+	mu       sync.RWMutex
 }
 
 func (c *contentType) set(name string, cname string) {
@@ -37,10 +44,57 @@ func (c *contentType) set(name string, cname string) {
 	c.subType[name] = cname
 }
 
-func (c *contentType) get(name string) encoding.Codec {
+func (c *contentType) setFallback(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fallback = names
+}
+
+func (c *contentType) codec(name string) encoding.Codec {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return encoding.GetCodec(c.subType[name])
 }
 
+// get returns the codec of a content type, e.g. "application/vnd.foo+json",
+// trying in order the exact subtype "vnd.foo+json", the "*+json" wildcard
+// and the suffix "json". A content type without subtype has no codec.
+// The fallback chain is not tried, it only applies to decoding, see
+// CodecForResponse.
+func (c *contentType) get(contentType string) encoding.Codec {
+	st := parseSubtype(contentType)
+	if st.sub == "" {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if st.exact != st.sub {
+		if codec := encoding.GetCodec(c.subType[st.exact]); codec != nil {
+			return codec
+		}
+	}
+	if st.suffix != "" {
+		if codec := encoding.GetCodec(c.subType[st.suffix]); codec != nil {
+			return codec
+		}
+	}
+	return encoding.GetCodec(c.subType[st.sub])
+}
+
+// fallbackCodec returns the first registered codec of the fallback chain.
+func (c *contentType) fallbackCodec() encoding.Codec {
+	c.mu.RLock()
+	fallback := c.fallback
+	c.mu.RUnlock()
+	for _, name := range fallback {
+		if codec := c.codec(name); codec != nil {
+			return codec
+		}
+	}
+	return nil
+}
+
 func RegisterCodecName(contentType string, name string) {
 	if name == "" {
 		return
@@ -56,37 +110,109 @@ func RegisterCodec(contentType string, codec encoding.Codec) {
 	defaultContentType.set(subContentType(contentType), codec.Name())
 }
 
+// RegisterCodecTypes registers codec for all the content types. A content
+// type of the form "*+suffix" matches every type with the structured syntax
+// suffix, e.g. "application/*+json" matches "application/vnd.foo+json":
+//
+//	ghttp.RegisterCodecTypes(codec, "application/json", "application/*+json")
+func RegisterCodecTypes(codec encoding.Codec, contentTypes ...string) {
+	if codec == nil {
+		return
+	}
+	encoding.RegisterCodec(codec)
+	for _, ct := range contentTypes {
+		if suffix := parseSubtype(ct).suffix; suffix != "" && strings.Contains(ct, "/*+") {
+			defaultContentType.set(suffix, codec.Name())
+			continue
+		}
+		defaultContentType.set(subContentType(ct), codec.Name())
+	}
+}
+
+// SetCodecFallback sets the content types whose codec decodes a content type
+// without registered codec, tried in order by CodecForRequest and
+// CodecForResponse, default: "*" (json). The client does not marshal request
+// bodies with the fallback.
+// "*" is the default codec, without content types there is no fallback:
+//
+//	ghttp.SetCodecFallback("application/xml", "*")
+func SetCodecFallback(contentTypes ...string) {
+	names := make([]string, 0, len(contentTypes))
+	for _, ct := range contentTypes {
+		if ct == "*" || ct == "*/*" {
+			names = append(names, "*")
+			continue
+		}
+		names = append(names, subContentType(ct))
+	}
+	defaultContentType.setFallback(names)
+}
+
+// codecContentTypes are the content types sent for the default codecs.
+var codecContentTypes = map[string]string{
+	json.Name:   "application/json",
+	proto.Name:  "application/x-protobuf",
+	xml.Name:    "application/xml",
+	yaml.Name:   "application/yaml",
+	plain.Name:  "text/plain",
+	binary.Name: "application/octet-stream",
+}
+
+// contentTypeOf returns the content type sent for the codec name, from
+// codecContentTypes for a default codec and otherwise "application/" with the
+// alphabetically first subtype registered for it, or false if it has none.
+func contentTypeOf(name string) (string, bool) {
+	if ct, ok := codecContentTypes[name]; ok {
+		return ct, true
+	}
+	defaultContentType.mu.RLock()
+	defer defaultContentType.mu.RUnlock()
+	var subTypes []string
+	for sub, cname := range defaultContentType.subType {
+		if cname == name && sub != "*" && !strings.HasPrefix(sub, "+") {
+			subTypes = append(subTypes, sub)
+		}
+	}
+	if len(subTypes) == 0 {
+		return "", false
+	}
+	sort.Strings(subTypes)
+	return "application/" + subTypes[0], true
+}
+
 // CodecForString get encoding.Codec via string
 func CodecForString(contentType string) encoding.Codec {
-	return defaultContentType.get(subContentType(contentType))
+	return defaultContentType.get(contentType)
 }
 
-// CodecForRequest get encoding.Codec via http.Request
+// CodecForRequest get encoding.Codec via http.Request, the codec of the
+// fallback chain if no content type has a codec, reporting false, see
+// SetCodecFallback.
 func CodecForRequest(r *http.Request, name ...string) (encoding.Codec, bool) {
 	headerName := "Content-Type"
 	if len(name) > 0 && name[0] != "" {
 		headerName = name[0]
 	}
 	for _, accept := range r.Header[headerName] {
-		codec := CodecForString(accept)
-		if codec != nil {
+		if codec := defaultContentType.get(accept); codec != nil {
 			return codec, true
 		}
 	}
-	return encoding.GetCodec(json.Name), false
+	return defaultContentType.fallbackCodec(), false
 }
 
-// CodecForResponse get encoding.Codec via http.Response
+// CodecForResponse get encoding.Codec via http.Response, the codec of the
+// fallback chain if no content type has a codec, reporting false, see
+// SetCodecFallback.
 func CodecForResponse(r *http.Response, name ...string) (encoding.Codec, bool) {
 	headerName := "Content-Type"
 	if len(name) > 0 && name[0] != "" {
 		headerName = name[0]
 	}
 	for _, accept := range r.Header[headerName] {
-		codec := CodecForString(accept)
-		if codec != nil {
+		if codec := defaultContentType.get(accept); codec != nil {
 			return codec, true
 		}
 	}
-	return encoding.GetCodec(json.Name), false
+	return defaultContentType.fallbackCodec(), false
 }
@@ -1,6 +1,11 @@
 package ghttp
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
 
 func TestCodecForString(t *testing.T) {
 	tests := []struct {
@@ -56,6 +61,12 @@ func TestCodecForString(t *testing.T) {
 			contentType: "application/x-protobuf",
 			want:        "proto",
 		},
+
+		// binary
+		{
+			contentType: "application/octet-stream",
+			want:        "binary",
+		},
 	}
 
 	for _, v := range tests {
@@ -72,3 +83,111 @@ func TestCodecForString(t *testing.T) {
 
 	}
 }
+
+type namedCodec struct {
+	name string
+}
+
+func (c namedCodec) Name() string                          { return c.name }
+func (c namedCodec) Marshal(v interface{}) ([]byte, error) { return nil, nil }
+func (c namedCodec) Unmarshal(data []byte, v interface{}) error {
+	return nil
+}
+
+func TestRegisterCodecTypes(t *testing.T) {
+	t.Cleanup(func() {
+		defaultContentType.mu.Lock()
+		delete(defaultContentType.subType, "+json")
+		delete(defaultContentType.subType, "x-ndjson")
+		delete(defaultContentType.subType, "+ndjson")
+		defaultContentType.mu.Unlock()
+	})
+
+	RegisterCodecTypes(namedCodec{"vnd-json"}, "application/*+json")
+	RegisterCodecTypes(namedCodec{"ndjson"}, "application/x-ndjson", "application/*+ndjson")
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		// suffix wildcard
+		{contentType: "application/vnd.foo+json", want: "vnd-json"},
+		{contentType: "application/vnd.api+json; charset=utf-8", want: "vnd-json"},
+		{contentType: "application/merge-patch+JSON", want: "vnd-json"},
+		// the exact type is not matched by the wildcard
+		{contentType: "application/json", want: "json"},
+		// multiple types in one call
+		{contentType: "application/x-ndjson", want: "ndjson"},
+		{contentType: "application/vnd.log+ndjson", want: "ndjson"},
+		// other suffixes fall back to the suffix subtype
+		{contentType: "application/atom+xml", want: "xml"},
+	}
+	for _, tt := range tests {
+		codec := CodecForString(tt.contentType)
+		if codec == nil || codec.Name() != tt.want {
+			t.Errorf("CodecForString(%q) = %v, want %s", tt.contentType, codec, tt.want)
+		}
+	}
+}
+
+func TestCodecFallback(t *testing.T) {
+	t.Cleanup(func() {
+		SetCodecFallback("*")
+		defaultContentType.mu.Lock()
+		delete(defaultContentType.subType, "vnd.exact+json")
+		defaultContentType.mu.Unlock()
+	})
+
+	defaultContentType.set("vnd.exact+json", "xml")
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		// exact subtype before the suffix
+		{contentType: "application/vnd.exact+json", want: "xml"},
+		// suffix
+		{contentType: "application/vnd.other+json", want: "json"},
+		// "*" default
+		{contentType: "application/vnd.custom", want: "json"},
+		{contentType: "application/vnd.custom; charset=utf-8", want: "json"},
+		{contentType: "text/csv", want: "json"},
+	}
+	for _, tt := range tests {
+		response := &http.Response{Header: http.Header{"Content-Type": {tt.contentType}}}
+		codec, _ := CodecForResponse(response)
+		if codec == nil || codec.Name() != tt.want {
+			t.Errorf("CodecForResponse(%q) = %v, want %s", tt.contentType, codec, tt.want)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Content-Type", "application/vnd.custom")
+	if codec, ok := CodecForRequest(req); ok || codec == nil || codec.Name() != "json" {
+		t.Errorf("CodecForRequest() = %v, %v, want json, false", codec, ok)
+	}
+
+	// the fallback only decodes, CodecForString and request bodies are strict
+	if codec := CodecForString("application/vnd.custom"); codec != nil {
+		t.Errorf("CodecForString() = %v, want nil", codec)
+	}
+	c := NewClient(WithContentType("application/x-www-form-urlencoded"))
+	_, err := c.NewRequest(context.Background(), http.MethodPost, "/", map[string]string{"a": "b"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported content type") {
+		t.Errorf("NewRequest() error = %v, want unsupported content type", err)
+	}
+
+	response := &http.Response{Header: http.Header{"Content-Type": {"application/vnd.custom"}}}
+	SetCodecFallback("application/xml")
+	if codec, ok := CodecForResponse(response); ok || codec == nil || codec.Name() != "xml" {
+		t.Errorf("CodecForResponse() = %v, %v, want xml, false", codec, ok)
+	}
+
+	SetCodecFallback()
+	if codec, _ := CodecForResponse(response); codec != nil {
+		t.Errorf("CodecForResponse() = %v, want nil", codec)
+	}
+	if codec := CodecForString("application/json"); codec == nil || codec.Name() != "json" {
+		t.Errorf("CodecForString() = %v, want json", codec)
+	}
+}
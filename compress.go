@@ -0,0 +1,91 @@
+package ghttp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodeContentEncoding replaces the body of a gzip or deflate encoded
+// response with the decoded body, as the transport does when it sets
+// Accept-Encoding itself. Other encodings are left as-is.
+func decodeContentEncoding(response *http.Response) error {
+	if response.Body == nil || response.Body == http.NoBody {
+		return nil
+	}
+
+	reader, err := newDecoder(response.Header.Get("Content-Encoding"), response.Body)
+	if err == io.EOF {
+		// empty body
+		return nil
+	}
+	if err != nil || reader == nil {
+		return err
+	}
+
+	response.Body = &decodedBody{Reader: reader, decoder: reader, body: response.Body}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+	return nil
+}
+
+// decodeBody returns the decoded body of a gzip or deflate encoded message,
+// body is returned as-is for other encodings or if it cannot be decoded.
+func decodeBody(encoding string, body []byte) []byte {
+	reader, err := newDecoder(encoding, bytes.NewReader(body))
+	if err != nil || reader == nil {
+		return body
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
+
+// newDecoder returns a reader decoding r, nil for other encodings than gzip
+// and deflate.
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return newDeflateReader(r)
+	}
+	return nil, nil
+}
+
+// newDeflateReader reads "deflate", which should be zlib wrapped but is sent
+// as raw deflate by some servers.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	// zlib header: CM = 8 and the header is a multiple of 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decodedBody closes both the decoder and the underlying body.
+type decodedBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	_ = d.decoder.Close()
+	return d.body.Close()
+}
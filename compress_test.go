@@ -0,0 +1,68 @@
+package ghttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithAcceptEncoding(t *testing.T) {
+	const body = `{"name":"acme"}`
+	compress := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	var gotAcceptEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+		encoding := r.URL.Query().Get("encoding")
+
+		var buf bytes.Buffer
+		cw := compress[encoding](&buf)
+		_, _ = cw.Write([]byte(body))
+		_ = cw.Close()
+
+		if encoding == "raw-deflate" {
+			encoding = "deflate"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithAcceptEncoding("gzip", "deflate"))
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			var reply struct {
+				Name string `json:"name"`
+			}
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply,
+				Query(map[string]string{"encoding": encoding}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotAcceptEncoding != "gzip, deflate" {
+				t.Errorf("Accept-Encoding = %q, want %q", gotAcceptEncoding, "gzip, deflate")
+			}
+			if reply.Name != "acme" {
+				t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+			}
+			if resp.Header.Get("Content-Encoding") != "" || !resp.Uncompressed {
+				t.Errorf("Content-Encoding = %q, Uncompressed = %t, want the decoded response",
+					resp.Header.Get("Content-Encoding"), resp.Uncompressed)
+			}
+		})
+	}
+}
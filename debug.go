@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net"
@@ -12,6 +14,7 @@ import (
 	"net/http/httptrace"
 	"os"
 	"strings"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 
@@ -24,9 +27,27 @@ type DebugInterface interface {
 }
 
 type Debug struct {
-	Writer        io.Writer
+	Writer io.Writer
+	// Trace reports the timings of the request, it relies on the transport
+	// honoring net/http/httptrace as *http.Transport does. With a custom
+	// RoundTripper that does not, the missing timings are zero.
 	Trace         bool
 	TraceCallback func(w io.Writer, info TraceInfo)
+	// NoDumpRequest does not print the request line, headers and body.
+	NoDumpRequest bool
+	// NoDumpResponse does not print the response status, headers and body.
+	NoDumpResponse bool
+	// HeaderFilter reports whether a request or response header is printed,
+	// all headers are printed if nil.
+	HeaderFilter func(key string) bool
+	// OnlyErrors prints nothing for requests without error and with a 2xx status.
+	OnlyErrors bool
+	// FormatCodec returns the codec used to format bodies whose content type
+	// has no registered codec, unless NoPretty is set.
+	FormatCodec func(contentType string) encoding.Codec
+	// NoPretty prints the raw request and response bodies as-is, by default
+	// they are formatted, json and xml are indented.
+	NoPretty bool
 
 	traceInfo traceInfo
 	req       *http.Request
@@ -72,11 +93,17 @@ func (d *Debug) Before(req *http.Request) {
 				d.traceInfo.gotFirstResponseByteTime = time.Now()
 			},
 			WroteRequest: func(info httptrace.WroteRequestInfo) {
-				d.traceInfo.wroteRequestTime = time.Now()
+				now := time.Now()
+				d.traceInfo.wroteRequestTime.Store(&now)
 			},
 		}
 
-		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = &countingReader{ReadCloser: req.Body, n: &d.traceInfo.requestBytes}
+		}
+
+		// update the request in place so that the trace applies to the request being sent
+		*req = *req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
 	}
 
 	d.req = req
@@ -86,26 +113,72 @@ func (d *Debug) statTraceInfo(ctx context.Context) TraceInfo {
 	if !d.Trace {
 		return TraceInfo{}
 	}
-	return TraceInfo{
+	wroteRequestTime := d.traceInfo.wroteRequest()
+	info := TraceInfo{
 		ctx:                  ctx,
-		DNSDuration:          d.traceInfo.dnsDoneTime.Sub(d.traceInfo.dnsStartTime),
-		ConnectDuration:      d.traceInfo.gotConnTime.Sub(d.traceInfo.getConnTime),
-		TLSHandshakeDuration: d.traceInfo.tlsHandshakeDoneTime.Sub(d.traceInfo.tlsHandshakeStartTime),
-		RequestDuration:      d.traceInfo.wroteRequestTime.Sub(d.traceInfo.gotConnTime),
-		WaitResponseDuration: d.traceInfo.gotFirstResponseByteTime.Sub(d.traceInfo.wroteRequestTime),
-
-		ResponseDuration: d.traceInfo.responseDoneTime.Sub(d.traceInfo.gotFirstResponseByteTime),
-		TotalDuration:    d.traceInfo.responseDoneTime.Sub(d.traceInfo.startTime),
+		DNSDuration:          elapsed(d.traceInfo.dnsStartTime, d.traceInfo.dnsDoneTime),
+		ConnectDuration:      elapsed(d.traceInfo.getConnTime, d.traceInfo.gotConnTime),
+		TLSHandshakeDuration: elapsed(d.traceInfo.tlsHandshakeStartTime, d.traceInfo.tlsHandshakeDoneTime),
+		RequestDuration:      elapsed(d.traceInfo.gotConnTime, wroteRequestTime),
+		WaitResponseDuration: elapsed(wroteRequestTime, d.traceInfo.gotFirstResponseByteTime),
+
+		ResponseDuration: elapsed(d.traceInfo.gotFirstResponseByteTime, d.traceInfo.responseDoneTime),
+		TotalDuration:    elapsed(d.traceInfo.startTime, d.traceInfo.responseDoneTime),
+
+		RequestBytes:  d.traceInfo.requestBytes.Load(),
+		ResponseBytes: d.traceInfo.responseBytes,
+	}
+	if connInfo := d.traceInfo.gotConnInfo; connInfo != nil {
+		info.Reused = connInfo.Reused
+		info.WasIdle = connInfo.WasIdle
+	}
+	if state := d.traceInfo.tlsConnectionState; state != nil {
+		info.TLSVersion = tls.VersionName(state.Version)
+		info.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		info.NegotiatedProtocol = state.NegotiatedProtocol
+		info.PeerCertificates = state.PeerCertificates
+	}
+	return info
+}
+
+// elapsed returns end - start, zero if either event did not happen, e.g. no
+// DNS lookup for an IP literal or no TLS handshake on a reused connection.
+// It is clamped to zero as a transport that does not honor httptrace may
+// report only some of the events.
+func elapsed(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	if d := end.Sub(start); d > 0 {
+		return d
 	}
+	return 0
 }
 
 func (d *Debug) After(request *http.Request, response *http.Response, err error) {
+	if d.OnlyErrors && err == nil && response != nil && !not2xxCode(response.StatusCode) {
+		return
+	}
+
 	// print request and response
 	path := request.URL.String()
 	if path == "" {
 		path = "/"
 	}
 
+	// read the response body first, so that it is counted by the trace
+	var responseBody []byte
+	var responseBodyErr error
+	// an event stream or an upgraded connection is not read, it does not end
+	if (d.Trace || !d.NoDumpResponse) && response != nil && response.Body != nil && response.Body != http.NoBody &&
+		response.StatusCode != http.StatusSwitchingProtocols &&
+		!strings.HasPrefix(response.Header.Get("Content-Type"), ContentTypeEventStream) {
+		responseBody, responseBodyErr = io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		response.Body = io.NopCloser(bytes.NewBuffer(responseBody))
+		d.traceInfo.responseBytes = int64(len(responseBody))
+	}
+
 	if d.Trace {
 		d.traceInfo.responseDoneTime = time.Now()
 		if d.TraceCallback != nil {
@@ -117,50 +190,52 @@ func (d *Debug) After(request *http.Request, response *http.Response, err error)
 		d.traceInfo.write(d.Writer)
 	}
 
-	write(d.Writer, "* using %s", request.Proto)
-	write(d.Writer, "> %s %s %s", request.Method, path, request.Proto)
-	// write request header
-	for k, v := range request.Header {
-		write(d.Writer, "> %s: %s", k, strings.Join(v, ","))
-	}
+	if !d.NoDumpRequest {
+		write(d.Writer, "* using %s", request.Proto)
+		write(d.Writer, "> %s %s %s", request.Method, path, request.Proto)
+		// write request header
+		for k, v := range request.Header {
+			if d.HeaderFilter != nil && !d.HeaderFilter(k) {
+				continue
+			}
+			write(d.Writer, "> %s: %s", k, strings.Join(v, ","))
+		}
 
-	// request body
-	if request.GetBody != nil {
-		if reqBodyReader, err := request.GetBody(); err == nil {
-			reqBody, _ := io.ReadAll(reqBodyReader)
-			codec, _ := CodecForRequest(request)
-			reqBodyBs, _ := formatIndent(codec, reqBody)
-			if len(reqBodyBs) > 0 {
-				write(d.Writer, "")
-				write(d.Writer, "%s", string(reqBodyBs))
+		// request body
+		if request.GetBody != nil {
+			if reqBodyReader, err := request.GetBody(); err == nil {
+				reqBody, _ := io.ReadAll(reqBodyReader)
+				_ = reqBodyReader.Close()
+				reqBody = decodeBody(request.Header.Get("Content-Encoding"), reqBody)
+				codec, ok := CodecForRequest(request)
+				codec = d.formatCodec(request.Header.Get("Content-Type"), codec, ok)
+				reqBodyBs := d.format(codec, reqBody)
+				if len(reqBodyBs) > 0 {
+					write(d.Writer, "")
+					write(d.Writer, "%s", string(reqBodyBs))
+				}
 			}
+		} else {
+			write(d.Writer, ">")
 		}
-	} else {
-		write(d.Writer, ">")
 	}
 
-	if response != nil {
+	if !d.NoDumpResponse && response != nil {
 		write(d.Writer, "")
 		// response
 		write(d.Writer, "< %s %s", response.Proto, response.Status)
 		for k, v := range response.Header {
+			if d.HeaderFilter != nil && !d.HeaderFilter(k) {
+				continue
+			}
 			write(d.Writer, "< %s: %s", k, strings.Join(v, ","))
 		}
 		// response body
-		if response.Body != nil && response.Body != http.NoBody {
-			//resBodyReader := io.Reader(response.Body)
-			if responseBody, err := io.ReadAll(response.Body); err == nil {
-				response.Body = io.NopCloser(bytes.NewBuffer(responseBody))
-				codec, _ := CodecForResponse(response)
-				resBodyBs, _ := formatIndent(codec, responseBody)
-				if len(resBodyBs) > 0 {
-					write(d.Writer, "")
-					write(d.Writer, "%s", string(resBodyBs))
-				} else {
-					write(d.Writer, "")
-					write(d.Writer, "%s", string(responseBody))
-				}
-			}
+		if len(responseBody) > 0 && responseBodyErr == nil {
+			codec, ok := CodecForResponse(response)
+			codec = d.formatCodec(response.Header.Get("Content-Type"), codec, ok)
+			write(d.Writer, "")
+			write(d.Writer, "%s", string(d.format(codec, responseBody)))
 		}
 	}
 
@@ -180,6 +255,21 @@ type TraceInfo struct {
 	WaitResponseDuration time.Duration `json:"waitResponseDuration,omitempty" yaml:"waitResponseDuration" xml:"waitResponseDuration"`
 	ResponseDuration     time.Duration `json:"responseDuration,omitempty" yaml:"responseDuration" xml:"responseDuration"`
 	TotalDuration        time.Duration `json:"totalDuration,omitempty" yaml:"totalDuration" xml:"totalDuration"`
+
+	// RequestBytes and ResponseBytes are the sizes of the request and response bodies.
+	RequestBytes  int64 `json:"requestBytes,omitempty" yaml:"requestBytes" xml:"requestBytes"`
+	ResponseBytes int64 `json:"responseBytes,omitempty" yaml:"responseBytes" xml:"responseBytes"`
+
+	// Reused reports whether the connection was previously used for another request.
+	Reused bool `json:"reused,omitempty" yaml:"reused" xml:"reused"`
+	// WasIdle reports whether the connection was obtained from the idle pool.
+	WasIdle bool `json:"wasIdle,omitempty" yaml:"wasIdle" xml:"wasIdle"`
+
+	// TLS connection details, empty for plain HTTP
+	TLSVersion         string              `json:"TLSVersion,omitempty" yaml:"TLSVersion" xml:"TLSVersion"`
+	CipherSuite        string              `json:"cipherSuite,omitempty" yaml:"cipherSuite" xml:"cipherSuite"`
+	NegotiatedProtocol string              `json:"negotiatedProtocol,omitempty" yaml:"negotiatedProtocol" xml:"negotiatedProtocol"`
+	PeerCertificates   []*x509.Certificate `json:"-" yaml:"-" xml:"-"`
 }
 
 func (t TraceInfo) Context() context.Context {
@@ -196,11 +286,21 @@ func (t TraceInfo) Table() []byte {
 	_, _ = fmt.Fprintln(w, "--------------------------------------------")
 	_, _ = fmt.Fprintln(w, "Trace\tValue\t")
 	_, _ = fmt.Fprintln(w, "--------------------------------------------")
-	_, _ = fmt.Fprintf(w, "DNSDuration\t%s\t\n", t.DNSDuration)
-	_, _ = fmt.Fprintf(w, "ConnectDuration\t%s\t\n", t.ConnectDuration)
-	_, _ = fmt.Fprintf(w, "TLSHandshakeDuration\t%s\t\n", t.TLSHandshakeDuration)
-	_, _ = fmt.Fprintf(w, "RequestDuration\t%s\t\n", t.RequestDuration)
-	_, _ = fmt.Fprintf(w, "WaitResponseDuration\t%s\t\n", t.WaitResponseDuration)
+	// phases that did not happen are not reported
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"DNSDuration", t.DNSDuration},
+		{"ConnectDuration", t.ConnectDuration},
+		{"TLSHandshakeDuration", t.TLSHandshakeDuration},
+		{"RequestDuration", t.RequestDuration},
+		{"WaitResponseDuration", t.WaitResponseDuration},
+	} {
+		if phase.d > 0 {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t\n", phase.name, phase.d)
+		}
+	}
 	_, _ = fmt.Fprintf(w, "TotalDuration\t%s\t\n", t.TotalDuration)
 	_, _ = fmt.Fprintln(w, "--------------------------------------------")
 
@@ -222,13 +322,26 @@ type traceInfo struct {
 	tlsHandshakeStartTime    time.Time
 	tlsHandshakeDoneTime     time.Time
 	gotFirstResponseByteTime time.Time
-	wroteRequestTime         time.Time
+	// set by the transport goroutine writing the request, which may still be
+	// writing it when the response is received
+	wroteRequestTime atomic.Pointer[time.Time]
 
 	startTime        time.Time
 	responseDoneTime time.Time
+
+	requestBytes  atomic.Int64
+	responseBytes int64
+}
+
+// wroteRequest returns the time the request was written, zero if it was not.
+func (t *traceInfo) wroteRequest() time.Time {
+	if wrote := t.wroteRequestTime.Load(); wrote != nil {
+		return *wrote
+	}
+	return time.Time{}
 }
 
-func (t traceInfo) write(w io.Writer) {
+func (t *traceInfo) write(w io.Writer) {
 	// print trace
 	if t.dnsDoneInfo != nil {
 		write(w, "* Host %s was resolved.", t.getConnHostPort)
@@ -242,7 +355,8 @@ func (t traceInfo) write(w io.Writer) {
 		}
 	}
 
-	if t.gotConnInfo != nil {
+	// a custom transport may report a connection without a net.Conn
+	if t.gotConnInfo != nil && t.gotConnInfo.Conn != nil {
 		remoteAddr := t.gotConnInfo.Conn.RemoteAddr()
 		write(w, "*   Trying %s...", remoteAddr)
 		ip, port, _ := net.SplitHostPort(remoteAddr.String())
@@ -270,6 +384,19 @@ func (t traceInfo) write(w io.Writer) {
 
 }
 
+// countingReader counts the bytes read from the underlying reader, which
+// the transport may do from another goroutine.
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
 func getFirst(s []string) string {
 	if len(s) > 0 {
 		return s[0]
@@ -284,22 +411,83 @@ func write(w io.Writer, format string, args ...any) {
 	_, _ = fmt.Fprintf(w, "\n")
 }
 
+// formatCodec returns the codec supplied by FormatCodec if no codec matched the content type.
+func (d *Debug) formatCodec(contentType string, codec encoding.Codec, matched bool) encoding.Codec {
+	if !matched && d.FormatCodec != nil {
+		if c := d.FormatCodec(contentType); c != nil {
+			return c
+		}
+	}
+	return codec
+}
+
+// format returns the body to print, the raw data is returned if NoPretty is
+// set or the body cannot be formatted.
+func (d *Debug) format(codec encoding.Codec, data []byte) []byte {
+	if d.NoPretty {
+		return data
+	}
+	result, err := formatIndent(codec, data)
+	if err != nil || len(result) == 0 {
+		return data
+	}
+	return result
+}
+
 func formatIndent(codec encoding.Codec, data []byte) (result []byte, err error) {
 	if len(data) == 0 || codec == nil {
 		return result, nil
 	}
 
+	switch codec.Name() {
+	case "xml":
+		return indentXML(data)
+	case "yaml":
+		// yaml is already human-readable
+		return data, nil
+	case "json":
+		// indent the raw bytes, a round trip through any turns large
+		// integers into floats, e.g. 1.2345678901234568e+18
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, "", "    "); err != nil {
+			return data, err
+		}
+		return buf.Bytes(), nil
+	}
+
 	var anyData any
 	if err = codec.Unmarshal(data, &anyData); err != nil {
 		return data, err
 	}
 
-	switch codec.Name() {
-	case "json":
-		result, err = json.MarshalIndent(anyData, "", "    ")
-	default:
-		result, err = codec.Marshal(anyData)
-	}
+	return codec.Marshal(anyData)
+}
 
-	return
+func indentXML(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "    ")
+	for {
+		// RawToken does not translate namespaces, so the encoder writes
+		// the names as they are.
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return data, err
+		}
+		// whitespace between elements is replaced by the encoder indentation
+		if cd, ok := tok.(xml.CharData); ok && len(bytes.TrimSpace(cd)) == 0 {
+			continue
+		}
+		if err = enc.EncodeToken(tok); err != nil {
+			return data, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return data, err
+	}
+	return buf.Bytes(), nil
 }
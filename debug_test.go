@@ -0,0 +1,641 @@
+package ghttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexuer/ghttp/encoding"
+)
+
+func TestDebug_Pretty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(`<user><name>acme</name><age>18</age></user>`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		pretty bool
+		want   string
+	}{
+		{
+			name:   "pretty",
+			pretty: true,
+			want:   "<user>\n    <name>acme</name>\n    <age>18</age>\n</user>",
+		},
+		{
+			name:   "raw",
+			pretty: false,
+			want:   "<user><name>acme</name><age>18</age></user>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithDebug(true),
+				WithDebugInterface(func() DebugInterface {
+					return &Debug{Writer: &buf, NoPretty: !tt.pretty}
+				}),
+			)
+			if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("debug output does not contain %q:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestDebug_TraceTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var info TraceInfo
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithTransport(srv.Client().Transport),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					info = ti
+				},
+			}
+		}),
+	)
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.TLSVersion == "" {
+		t.Errorf("TLSVersion is empty")
+	}
+	if info.CipherSuite == "" {
+		t.Errorf("CipherSuite is empty")
+	}
+	if len(info.PeerCertificates) == 0 {
+		t.Fatalf("PeerCertificates is empty")
+	}
+	if !info.PeerCertificates[0].Equal(srv.Certificate()) {
+		t.Errorf("PeerCertificates[0] is not the server certificate")
+	}
+}
+
+func TestDebug_TraceReused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var infos []TraceInfo
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithTransport(&http.Transport{}),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					infos = append(infos, ti)
+				},
+			}
+		}),
+	)
+	for i := 0; i < 2; i++ {
+		var reply any
+		if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("got %d trace infos, want 2", len(infos))
+	}
+	if infos[0].Reused {
+		t.Errorf("first request Reused = true, want false")
+	}
+	if !infos[1].Reused || !infos[1].WasIdle {
+		t.Errorf("second request Reused = %t, WasIdle = %t, want true, true", infos[1].Reused, infos[1].WasIdle)
+	}
+}
+
+func TestDebug_TraceSkippedPhases(t *testing.T) {
+	// httptest servers listen on an IP literal, there is no DNS lookup
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var infos []TraceInfo
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithTransport(srv.Client().Transport),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					infos = append(infos, ti)
+				},
+			}
+		}),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(infos) != 2 {
+		t.Fatalf("got %d trace infos, want 2", len(infos))
+	}
+
+	first, reused := infos[0], infos[1]
+	if first.DNSDuration != 0 {
+		t.Errorf("IP literal DNSDuration = %s, want 0", first.DNSDuration)
+	}
+	if first.TLSHandshakeDuration <= 0 {
+		t.Errorf("new connection TLSHandshakeDuration = %s, want > 0", first.TLSHandshakeDuration)
+	}
+	if strings.Contains(first.String(), "DNSDuration") {
+		t.Errorf("Table() reports DNSDuration for an IP literal:\n%s", first)
+	}
+
+	if !reused.Reused {
+		t.Fatalf("second request Reused = false, want true")
+	}
+	if reused.DNSDuration != 0 || reused.TLSHandshakeDuration != 0 {
+		t.Errorf("reused connection DNSDuration = %s, TLSHandshakeDuration = %s, want 0, 0",
+			reused.DNSDuration, reused.TLSHandshakeDuration)
+	}
+	if strings.Contains(reused.String(), "TLSHandshakeDuration") {
+		t.Errorf("Table() reports TLSHandshakeDuration for a reused connection:\n%s", reused)
+	}
+	if reused.TotalDuration <= 0 {
+		t.Errorf("TotalDuration = %s, want > 0", reused.TotalDuration)
+	}
+}
+
+// partialTraceTransport honors only the GotConn event of httptrace.
+type partialTraceTransport struct{}
+
+func (partialTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{})
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestDebug_TraceCustomTransport(t *testing.T) {
+	var info TraceInfo
+	c := NewClient(
+		WithEndpoint("http://example.com"),
+		WithTransport(partialTraceTransport{}),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					info = ti
+				},
+			}
+		}),
+	)
+	var reply any
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	durations := map[string]time.Duration{
+		"DNSDuration":          info.DNSDuration,
+		"ConnectDuration":      info.ConnectDuration,
+		"TLSHandshakeDuration": info.TLSHandshakeDuration,
+		"RequestDuration":      info.RequestDuration,
+		"WaitResponseDuration": info.WaitResponseDuration,
+		"ResponseDuration":     info.ResponseDuration,
+		"TotalDuration":        info.TotalDuration,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			t.Errorf("%s = %s, want >= 0", name, d)
+		}
+	}
+	// no first response byte was reported, the phase did not happen
+	if info.ResponseDuration != 0 {
+		t.Errorf("ResponseDuration = %s, want 0", info.ResponseDuration)
+	}
+}
+
+func TestDebug_TraceBytes(t *testing.T) {
+	const response = `{"name":"acme","age":18}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	var info TraceInfo
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					info = ti
+				},
+			}
+		}),
+	)
+
+	args := map[string]string{"name": "acme"}
+	var reply struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	if _, err := c.Invoke(context.Background(), http.MethodPost, "/", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(len(`{"name":"acme"}`)); info.RequestBytes != want {
+		t.Errorf("RequestBytes = %d, want %d", info.RequestBytes, want)
+	}
+	if want := int64(len(response)); info.ResponseBytes != want {
+		t.Errorf("ResponseBytes = %d, want %d", info.ResponseBytes, want)
+	}
+	// the body is still bound after counting
+	if reply.Name != "acme" || reply.Age != 18 {
+		t.Errorf("reply = %+v, want {Name:acme Age:18}", reply)
+	}
+}
+
+func TestDebug_Sections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	const (
+		traceSection    = "Trace"
+		requestSection  = "> GET "
+		responseSection = "< HTTP/1.1 200 OK"
+	)
+
+	tests := []struct {
+		name         string
+		trace        bool
+		dumpRequest  bool
+		dumpResponse bool
+	}{
+		{name: "none"},
+		{name: "trace", trace: true},
+		{name: "request", dumpRequest: true},
+		{name: "response", dumpResponse: true},
+		{name: "request and response", dumpRequest: true, dumpResponse: true},
+		{name: "all", trace: true, dumpRequest: true, dumpResponse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithDebug(true),
+				WithDebugInterface(func() DebugInterface {
+					return &Debug{
+						Writer:         &buf,
+						Trace:          tt.trace,
+						NoDumpRequest:  !tt.dumpRequest,
+						NoDumpResponse: !tt.dumpResponse,
+						TraceCallback: func(w io.Writer, info TraceInfo) {
+							_, _ = w.Write(info.Table())
+						},
+					}
+				}),
+			)
+			if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			for section, want := range map[string]bool{
+				traceSection:    tt.trace,
+				requestSection:  tt.dumpRequest,
+				responseSection: tt.dumpResponse,
+			} {
+				if got := strings.Contains(out, section); got != want {
+					t.Errorf("output contains %q = %t, want %t:\n%s", section, got, want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDebug_ZeroValue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	// the dumps and pretty printing are on unless turned off
+	var buf bytes.Buffer
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{Writer: &buf, Trace: true}
+		}),
+	)
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"> GET ", "< HTTP/1.1 200 OK", "{\n    \"name\": \"acme\"\n}"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDebug_HeaderFilter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "abc")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: &buf,
+				HeaderFilter: func(key string) bool {
+					return !strings.HasPrefix(key, "X-")
+				},
+			}
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Trace-Id", "def")
+	if _, err = c.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, header := range []string{"> Content-Type:", "< Content-Type:"} {
+		if !strings.Contains(out, header) {
+			t.Errorf("output does not contain %q:\n%s", header, out)
+		}
+	}
+	for _, header := range []string{"> X-Trace-Id:", "< X-Request-Id:"} {
+		if strings.Contains(out, header) {
+			t.Errorf("output contains filtered header %q:\n%s", header, out)
+		}
+	}
+}
+
+func TestDebug_OnlyErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message":"internal error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{
+			path: "/ok",
+			want: nil,
+		},
+		{
+			path: "/fail",
+			want: []string{"> GET ", "< HTTP/1.1 500 Internal Server Error", `"message": "internal error"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithDebug(true),
+				WithDebugInterface(func() DebugInterface {
+					return &Debug{
+						Writer:     &buf,
+						Trace:      true,
+						OnlyErrors: true,
+					}
+				}),
+			)
+			if _, err := c.Invoke(context.Background(), http.MethodGet, tt.path, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			if tt.want == nil && out != "" {
+				t.Errorf("output = %q, want empty", out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+// csvCodec formats csv rows as a table, for debug output only.
+type csvCodec struct{}
+
+func (csvCodec) Name() string {
+	return "csv"
+}
+
+func (csvCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, row := range v.([][]string) {
+		buf.WriteString(strings.Join(row, " | "))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (csvCodec) Unmarshal(data []byte, v any) error {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return err
+	}
+	*(v.(*any)) = rows
+	return nil
+}
+
+func TestDebug_FormatCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		_, _ = w.Write([]byte("name,age\nacme,18\n"))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: &buf,
+				FormatCodec: func(contentType string) encoding.Codec {
+					if strings.HasPrefix(contentType, "text/csv") {
+						return csvCodec{}
+					}
+					return nil
+				},
+			}
+		}),
+	)
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "name | age\nacme | 18\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("debug output does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestDebug_GzipRequestBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(`{"name":"acme"}`))
+	_ = zw.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{Writer: &buf}
+		}),
+	)
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(gz.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if _, err = c.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{\n    \"name\": \"acme\"\n}"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("debug output does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestDebug_PrettyLargeNumbers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1234567890123456789,"price":0.10,"name":"a<b"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{Writer: &buf}
+		}),
+	)
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{\n    \"id\": 1234567890123456789,\n    \"price\": 0.10,\n    \"name\": \"a<b\"\n}"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("debug output does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestDebug_TraceBytesEarlyResponse(t *testing.T) {
+	// the server responds without reading the body, the transport may still
+	// be writing it while After reads the count
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer srv.Close()
+
+	var info TraceInfo
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return &Debug{
+				Writer: io.Discard,
+				Trace:  true,
+				TraceCallback: func(w io.Writer, ti TraceInfo) {
+					info = ti
+				},
+			}
+		}),
+	)
+
+	args := strings.Repeat("x", 4<<20)
+	for i := 0; i < 5; i++ {
+		if response, err := c.Invoke(context.Background(), http.MethodPost, "/", args, nil); err == nil {
+			_ = response.Body.Close()
+		}
+		// the JSON string is quoted
+		if info.RequestBytes > int64(len(args)+2) {
+			t.Errorf("RequestBytes = %d, want at most %d", info.RequestBytes, len(args)+2)
+		}
+	}
+}
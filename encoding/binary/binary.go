@@ -0,0 +1,49 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/nexuer/ghttp/encoding"
+)
+
+const Name = "binary"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec passes raw bytes through, e.g. for application/octet-stream.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case *[]byte:
+		return *val, nil
+	case io.Reader:
+		return io.ReadAll(val)
+	default:
+		return nil, fmt.Errorf("supports only []byte or io.Reader, got: %v", reflect.TypeOf(v))
+	}
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	switch val := v.(type) {
+	case *[]byte:
+		*val = append([]byte(nil), data...)
+	case io.Writer:
+		_, err := io.Copy(val, bytes.NewReader(data))
+		return err
+	default:
+		return fmt.Errorf("supports only *[]byte or io.Writer, got: %v", reflect.TypeOf(v))
+	}
+	return nil
+}
+
+func (codec) Name() string {
+	return Name
+}
@@ -0,0 +1,59 @@
+package binary
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	c := codec{}
+	data := []byte{0x00, 0xff, 0x7f, '\n', 0x80}
+
+	tests := []struct {
+		name  string
+		input any
+	}{
+		{name: "bytes", input: data},
+		{name: "pointer to bytes", input: &data},
+		{name: "reader", input: bytes.NewReader(data)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Marshal(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Marshal() = %v, want %v", got, data)
+			}
+
+			var b []byte
+			if err = c.Unmarshal(got, &b); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("Unmarshal() = %v, want %v", b, data)
+			}
+
+			var buf bytes.Buffer
+			if err = c.Unmarshal(got, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("Unmarshal() = %v, want %v", buf.Bytes(), data)
+			}
+		})
+	}
+}
+
+func TestCodec_Unsupported(t *testing.T) {
+	c := codec{}
+	if _, err := c.Marshal(map[string]string{}); err == nil {
+		t.Error("Marshal(map) want error")
+	}
+	var s string
+	if err := c.Unmarshal([]byte("data"), &s); err == nil || !strings.Contains(err.Error(), "*[]byte or io.Writer") {
+		t.Errorf("Unmarshal(*string) error = %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package encoding
 
-import "strings"
+import (
+	"bytes"
+	"strings"
+)
 
 // Codec defines the interface Transport uses to encode and decode messages.  Note
 // that implementations of this interface must be thread safe; a Codec's
@@ -16,6 +19,14 @@ type Codec interface {
 	Name() string
 }
 
+// BufferMarshaler is implemented by a Codec that can write the wire format
+// of v into buf, which lets the client marshal request bodies into pooled
+// buffers instead of allocating one for every call.
+type BufferMarshaler interface {
+	// MarshalBuffer appends the wire format of v to buf, the same as Marshal.
+	MarshalBuffer(buf *bytes.Buffer, v interface{}) error
+}
+
 var registeredCodecs = make(map[string]Codec)
 
 func RegisterCodec(codec Codec) {
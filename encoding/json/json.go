@@ -1,7 +1,10 @@
 package json
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"reflect"
 
 	"github.com/nexuer/ghttp/encoding"
@@ -22,6 +25,10 @@ var (
 	UnmarshalOptions = protojson.UnmarshalOptions{
 		DiscardUnknown: true,
 	}
+	// UseNumber decodes a number into an interface{} as a json.Number
+	// instead of a float64, preserving integers beyond 2^53, e.g. int64 IDs.
+	// Set it before any request is sent.
+	UseNumber = false
 )
 
 func init() {
@@ -42,6 +49,26 @@ func (codec) Marshal(v interface{}) ([]byte, error) {
 	}
 }
 
+// MarshalBuffer is Marshal into buf, a value without custom marshaling is
+// encoded into buf directly.
+func (c codec) MarshalBuffer(buf *bytes.Buffer, v interface{}) error {
+	switch v.(type) {
+	case json.Marshaler, proto.Message:
+		data, err := c.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// as json.Marshal, without the newline of Encode
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
 func (codec) Unmarshal(data []byte, v interface{}) error {
 	switch m := v.(type) {
 	case json.Unmarshaler:
@@ -59,8 +86,24 @@ func (codec) Unmarshal(data []byte, v interface{}) error {
 		if m, ok := reflect.Indirect(rv).Interface().(proto.Message); ok {
 			return UnmarshalOptions.Unmarshal(data, m)
 		}
-		return json.Unmarshal(data, m)
+		return unmarshal(data, m)
+	}
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	if !UseNumber {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// as json.Unmarshal, only a single value is valid
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("json: invalid character after top-level value")
 	}
+	return nil
 }
 
 func (codec) Name() string {
@@ -1,6 +1,11 @@
 package json
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestCodec_Marshal(t *testing.T) {
 	c := codec{}
@@ -24,3 +29,83 @@ func TestCodec_Marshal(t *testing.T) {
 		}
 	}
 }
+
+func TestCodec_UseNumber(t *testing.T) {
+	defer func(useNumber bool) { UseNumber = useNumber }(UseNumber)
+
+	c := codec{}
+	data := []byte(`{"id":1234567890123456789}`)
+
+	var lossy map[string]any
+	if err := c.Unmarshal(data, &lossy); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lossy["id"].(float64); !ok {
+		t.Errorf("id = %T, want float64", lossy["id"])
+	}
+
+	UseNumber = true
+	var m map[string]any
+	if err := c.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	n, ok := m["id"].(json.Number)
+	if !ok {
+		t.Fatalf("id = %T, want json.Number", m["id"])
+	}
+	if id, err := n.Int64(); err != nil || id != 1234567890123456789 {
+		t.Errorf("id = %d, %v, want 1234567890123456789", id, err)
+	}
+
+	// typed fields are not affected
+	var typed struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.Unmarshal(data, &typed); err != nil || typed.ID != 1234567890123456789 {
+		t.Errorf("ID = %d, %v, want 1234567890123456789", typed.ID, err)
+	}
+
+	if err := c.Unmarshal([]byte(`{"id":1} {}`), &m); err == nil {
+		t.Error("Unmarshal() with trailing data: want error")
+	}
+}
+
+type rawMarshaler struct{}
+
+func (rawMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"raw"`), nil
+}
+
+func TestCodec_MarshalBuffer(t *testing.T) {
+	c := codec{}
+
+	tests := []interface{}{
+		nil,
+		"",
+		"<a&b>",
+		map[string]any{"b": 1, "a": []int{1, 2}},
+		struct {
+			Name string `json:"name"`
+		}{Name: "acme"},
+		rawMarshaler{},
+	}
+	for _, input := range tests {
+		want, err := c.Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.WriteString("prefix")
+		if err = c.MarshalBuffer(&buf, input); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimPrefix(buf.String(), "prefix"); got != string(want) {
+			t.Errorf("MarshalBuffer(%#v) = %q, want %q", input, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.MarshalBuffer(&buf, make(chan int)); err == nil || buf.Len() != 0 {
+		t.Errorf("MarshalBuffer(chan) = %q, %v, want an error", buf.String(), err)
+	}
+}
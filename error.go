@@ -3,17 +3,28 @@ package ghttp
 import (
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Error struct {
 	URL        *url.URL
 	Method     string
 	StatusCode int
-	Err        error
+	// Header is the header of the response, nil if there is no response.
+	Header http.Header
+	// SentBytes and ReceivedBytes are the bytes of the request and response
+	// bodies transferred by the last attempt when the error occurred, e.g.
+	// to diagnose a response body cut off mid-stream or a connection dropped
+	// mid-upload. Headers are not counted.
+	SentBytes     int64
+	ReceivedBytes int64
+	Err           error
 }
 
 func newError(req *http.Request, response *http.Response, err error) *Error {
@@ -24,10 +35,106 @@ func newError(req *http.Request, response *http.Response, err error) *Error {
 	}
 	if response != nil {
 		e.StatusCode = response.StatusCode
+		e.Header = response.Header
+	}
+	if stats := transferStatsFrom(req.Context()); stats != nil {
+		e.SentBytes = stats.sent.Load()
+		e.ReceivedBytes = stats.received.Load()
 	}
 	return e
 }
 
+type transferStatsKey struct{}
+
+// transferStats counts the body bytes of the attempts of a request.
+type transferStats struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func withTransferStats(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), transferStatsKey{}, &transferStats{}))
+}
+
+func transferStatsFrom(ctx context.Context) *transferStats {
+	stats, _ := ctx.Value(transferStatsKey{}).(*transferStats)
+	return stats
+}
+
+// countingReadCloser adds the bytes read to n.
+type countingReadCloser struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+// newCountingReadCloser wraps rc in a countingReadCloser that keeps the
+// io.Writer and io.WriterTo interfaces of rc.
+func newCountingReadCloser(rc io.ReadCloser, n *atomic.Int64) io.ReadCloser {
+	c := &countingReadCloser{ReadCloser: rc, n: n}
+	w, isWriter := rc.(io.Writer)
+	_, isWriterTo := rc.(io.WriterTo)
+	switch {
+	case isWriter && isWriterTo:
+		return &countingReadWriterTo{countingWriterTo{c}, w}
+	case isWriter:
+		return &countingReadWriteCloser{c, w}
+	case isWriterTo:
+		return countingWriterTo{c}
+	}
+	return c
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type countingWriterTo struct {
+	*countingReadCloser
+}
+
+func (c countingWriterTo) WriteTo(w io.Writer) (int64, error) {
+	n, err := c.ReadCloser.(io.WriterTo).WriteTo(w)
+	c.n.Add(n)
+	return n, err
+}
+
+type countingReadWriteCloser struct {
+	*countingReadCloser
+	io.Writer
+}
+
+type countingReadWriterTo struct {
+	countingWriterTo
+	io.Writer
+}
+
+// RetryAfter returns the delay requested by the Retry-After header of the
+// response, given in seconds or as an HTTP date.
+func (e Error) RetryAfter() (time.Duration, bool) {
+	v := e.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// RequestID returns the X-Request-Id header of the response, falling back
+// to X-Correlation-Id.
+func (e Error) RequestID() string {
+	if id := e.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	return e.Header.Get("X-Correlation-Id")
+}
+
 func (e Error) Error() string {
 	var buf strings.Builder
 
@@ -59,6 +166,53 @@ func (e Error) Unwrap() error {
 	return e.Err
 }
 
+// LimiterError is returned when the Limiter does not admit a request.
+type LimiterError struct {
+	// Err is the error returned by Limiter.Wait.
+	Err error
+	// ctxErr is the context error that caused the wait to fail, if any.
+	ctxErr error
+}
+
+func newLimiterError(ctx context.Context, err error) *LimiterError {
+	e := &LimiterError{Err: err, ctxErr: ctx.Err()}
+	// limiters such as rate.Limiter fail fast when the wait would exceed
+	// the deadline, before the context is actually done. Other errors, e.g.
+	// a request exceeding the burst, are not timeouts.
+	if e.ctxErr == nil && exceedsDeadline(ctx, err) {
+		e.ctxErr = context.DeadlineExceeded
+	}
+	return e
+}
+
+// exceedsDeadline reports whether a limiter error says that the wait would
+// exceed the deadline of ctx. Only the exact error of rate.Limiter.Wait is
+// recognized, TestExceedsDeadline_RateLimiter fails if its wording changes.
+func exceedsDeadline(ctx context.Context, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "rate: Wait(n=") && strings.HasSuffix(msg, ") would exceed context deadline")
+}
+
+func (e *LimiterError) Error() string {
+	return "limiter: " + e.Err.Error()
+}
+
+func (e *LimiterError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the wait failed because of the context, so that
+// errors.Is(err, context.DeadlineExceeded) and IsTimeout work as expected.
+func (e *LimiterError) Is(target error) bool {
+	return e.ctxErr != nil && e.ctxErr == target
+}
+
 func IsTimeout(err error) bool {
 	if err == nil {
 		return false
@@ -1,11 +1,20 @@
 package ghttp
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 // test gitlab
@@ -65,3 +74,279 @@ func TestError_Unwrap(t *testing.T) {
 	var ge2 *gitlabErr
 	t.Logf("errors.As(Error, gitlabErr): %t - gitlab err: %v", errors.As(e, &ge2), ge2)
 }
+
+func TestIsTimeout_Limiter(t *testing.T) {
+	c := NewClient(
+		WithTimeout(10*time.Millisecond),
+		WithLimiter(rate.NewLimiter(rate.Every(time.Second), 1)),
+	)
+	// consume the only token
+	req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	if err := c.wait(req); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.Invoke(context.Background(), http.MethodGet, "http://127.0.0.1", nil, nil)
+	if err == nil {
+		t.Fatal("Invoke() error = nil, want limiter error")
+	}
+	var le *LimiterError
+	if !errors.As(err, &le) {
+		t.Errorf("errors.As(%v, *LimiterError) = false, want true", err)
+	}
+	if !IsTimeout(err) {
+		t.Errorf("IsTimeout(%v) = false, want true", err)
+	}
+	if _, ok := StatusForErr(err); !ok {
+		t.Errorf("StatusForErr(%v) ok = false, want true", err)
+	}
+}
+
+func TestIsTimeout_LimiterBurst(t *testing.T) {
+	// every request exceeds a burst of 0, with the deadline of the timeout
+	c := NewClient(
+		WithTimeout(time.Second),
+		WithLimiter(rate.NewLimiter(rate.Every(time.Second), 0)),
+	)
+	_, err := c.Invoke(context.Background(), http.MethodGet, "http://127.0.0.1", nil, nil)
+	var le *LimiterError
+	if !errors.As(err, &le) {
+		t.Fatalf("errors.As(%v, *LimiterError) = false, want true", err)
+	}
+	if IsTimeout(err) {
+		t.Errorf("IsTimeout(%v) = true, want false", err)
+	}
+	if !strings.Contains(err.Error(), "burst") {
+		t.Errorf("error = %v, want the limiter error", err)
+	}
+}
+
+func TestExceedsDeadline_RateLimiter(t *testing.T) {
+	l := rate.NewLimiter(rate.Every(time.Hour), 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the exact error of rate.Limiter, a change of its wording must fail here
+	err := l.Wait(ctx)
+	if err == nil || err.Error() != "rate: Wait(n=1) would exceed context deadline" {
+		t.Fatalf("rate.Limiter.Wait() error = %v", err)
+	}
+	if !exceedsDeadline(ctx, err) {
+		t.Errorf("exceedsDeadline(%v) = false, want true", err)
+	}
+
+	// similar errors of other limiters, or without a deadline, do not match
+	if exceedsDeadline(ctx, errors.New("quota: would exceed context deadline")) {
+		t.Error("exceedsDeadline() of another limiter = true, want false")
+	}
+	if exceedsDeadline(context.Background(), err) {
+		t.Error("exceedsDeadline() without a deadline = true, want false")
+	}
+}
+
+func TestError_Header(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req-123")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"rate_limited"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithNot2xxError(func() error { return &gitlabErr{} }),
+	)
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	if e.Header.Get("Date") == "" {
+		t.Error("Header has no Date")
+	}
+	if got := e.RequestID(); got != "req-123" {
+		t.Errorf("RequestID() = %q, want %q", got, "req-123")
+	}
+	if got, ok := e.RetryAfter(); !ok || got != 30*time.Second {
+		t.Errorf("RetryAfter() = %s, %t, want 30s, true", got, ok)
+	}
+}
+
+func TestError_RetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{value: "", want: 0, wantOk: false},
+		{value: "120", want: 2 * time.Minute, wantOk: true},
+		{value: "-1", want: 0, wantOk: false},
+		{value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOk: true},
+		{value: "soon", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			e := Error{Header: http.Header{}}
+			if tt.value != "" {
+				e.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := e.RetryAfter()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("RetryAfter() = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	// no response
+	if _, ok := (Error{}).RetryAfter(); ok {
+		t.Error("RetryAfter() without a response = true, want false")
+	}
+}
+
+func TestError_TransferredBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		// announce 100 bytes, send 10 and close the connection
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"name":"a`))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	var reply map[string]any
+	_, err := NewClient(WithEndpoint(srv.URL)).
+		Invoke(context.Background(), http.MethodPost, "/", map[string]string{"name": "acme"}, &reply)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Invoke() error = %v, want *Error", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Invoke() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if want := int64(len(`{"name":"acme"}`)); e.SentBytes != want {
+		t.Errorf("SentBytes = %d, want %d", e.SentBytes, want)
+	}
+	if e.ReceivedBytes != 10 {
+		t.Errorf("ReceivedBytes = %d, want 10", e.ReceivedBytes)
+	}
+}
+
+func TestError_TransferredBytes_Upload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// read a part of the body and drop the connection
+		_, _ = io.CopyN(io.Discard, r.Body, 1<<20)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	body := strings.Repeat("a", 32<<20)
+	_, err := NewClient(WithEndpoint(srv.URL)).
+		Invoke(context.Background(), http.MethodPost, "/", body, nil)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Invoke() error = %v, want *Error", err)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("Invoke() error = %v, want a *url.Error", err)
+	}
+	if e.SentBytes < 1<<20 || e.SentBytes >= int64(len(body)) {
+		t.Errorf("SentBytes = %d, want a part of the %d bytes", e.SentBytes, len(body))
+	}
+}
+
+// writerToBody is a body implementing io.Writer and io.WriterTo.
+type writerToBody struct {
+	*strings.Reader
+	written strings.Builder
+}
+
+func (b *writerToBody) Write(p []byte) (int, error) { return b.written.Write(p) }
+func (b *writerToBody) Close() error                { return nil }
+
+func TestCountingReadCloser_Interfaces(t *testing.T) {
+	var n atomic.Int64
+	body := &writerToBody{Reader: strings.NewReader("hello")}
+	rc := newCountingReadCloser(body, &n)
+
+	wt, ok := rc.(io.WriterTo)
+	if !ok {
+		t.Fatal("the wrapper is not an io.WriterTo")
+	}
+	var out strings.Builder
+	if _, err := wt.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello" || n.Load() != 5 {
+		t.Errorf("WriteTo() = %q, counted %d, want hello, 5", out.String(), n.Load())
+	}
+
+	w, ok := rc.(io.Writer)
+	if !ok {
+		t.Fatal("the wrapper is not an io.Writer")
+	}
+	_, _ = w.Write([]byte("ping"))
+	if body.written.String() != "ping" {
+		t.Errorf("written = %q, want ping", body.written.String())
+	}
+
+	// a plain body stays a plain io.ReadCloser
+	rc = newCountingReadCloser(io.NopCloser(strings.NewReader("x")), &n)
+	if _, ok = rc.(io.Writer); ok {
+		t.Error("the wrapper of a plain body is an io.Writer")
+	}
+}
+
+func TestError_TransferredBytes_SwitchingProtocols(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		_ = rw.Flush()
+		line, _ := rw.ReadString('\n')
+		_, _ = rw.WriteString(line)
+		_ = rw.Flush()
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	response, err := c.roundTrip(withTransferStats(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	// the upgraded connection is not wrapped
+	rwc, ok := response.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("the body of a 101 is a %T, want an io.ReadWriteCloser", response.Body)
+	}
+	if _, err = io.WriteString(rwc, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(rwc).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Errorf("ReadString() = %q, %v, want ping", line, err)
+	}
+}
@@ -0,0 +1,168 @@
+package ghttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// sniffLen is the number of bytes considered by http.DetectContentType.
+const sniffLen = 512
+
+// FileBody streams the file at path as the request body, overriding the args
+// of Invoke, without reading it into memory:
+//
+//	client.Invoke(ctx, http.MethodPut, "/uploads/report.pdf", nil, &reply, ghttp.FileBody("report.pdf"))
+//
+// The Content-Type is sniffed from the first 512 bytes with
+// http.DetectContentType and the Content-Length is the size of the file.
+// The file is closed by the transport once the request is sent, or by the
+// client when a later option fails, GetBody reopens it for a retry or a
+// redirect.
+func FileBody(path string) CallOption {
+	return fileBodyCallOption{path: path}
+}
+
+type fileBodyCallOption struct {
+	path string
+}
+
+func (f fileBodyCallOption) Before(request *http.Request) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		_ = file.Close()
+		return fmt.Errorf("file body: %s is not a regular file", f.path)
+	}
+
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	if info.Size() == 0 {
+		_ = file.Close()
+		request.Body = http.NoBody
+		request.ContentLength = 0
+		request.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return nil
+	}
+	request.Body = file
+	request.ContentLength = info.Size()
+	request.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(f.path)
+	}
+	return nil
+}
+
+func (f fileBodyCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// sniffContentType detects the content type of the first bytes of file and
+// rewinds it.
+func sniffContentType(file *os.File) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// DownloadToFile sends a GET request and streams the response body to the
+// file at dest, creating its parent directories:
+//
+//	err := client.DownloadToFile(ctx, "/releases/v1.2.0.tar.gz", "dist/v1.2.0.tar.gz")
+//
+// The body is written to a temporary file in the same directory, renamed to
+// dest once complete, so that dest is either the whole body or left as it
+// was. The client timeout is the deadline of the whole download, including
+// reading the body, WithPerAttemptTimeout does not apply. The temporary file
+// is removed on failure.
+func (c *Client) DownloadToFile(ctx context.Context, path, dest string, opts ...CallOption) error {
+	req, _, err := c.newRequest(ctx, http.MethodGet, path, nil, false)
+	if err != nil {
+		return err
+	}
+	req = withStream(req)
+	req, cancel, err := c.admit(req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	response, err := c.do(req, opts...)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if !c.isSuccess(response.StatusCode) {
+		return newError(req, response, fmt.Errorf("download: unexpected status %s", response.Status))
+	}
+
+	if err = writeFile(req.Context(), dest, response.Body); err != nil {
+		return newError(req, response, fmt.Errorf("download: %w", err))
+	}
+	return nil
+}
+
+// writeFile writes body to dest through a temporary file renamed once
+// complete, closing body to interrupt a blocked read when ctx is done.
+func writeFile(ctx context.Context, dest string, body io.ReadCloser) (err error) {
+	dir := filepath.Dir(dest)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = body.Close()
+	})
+	_, err = io.Copy(tmp, body)
+	if !stop() {
+		// the body was closed by ctx
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file with 0600
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
@@ -0,0 +1,176 @@
+package ghttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileBody(t *testing.T) {
+	dir := t.TempDir()
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), bytes.Repeat([]byte{0}, 1024)...)
+	files := map[string][]byte{
+		"image.png":  png,
+		"notes.txt":  []byte("hello world"),
+		"empty.json": nil,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var attempts atomic.Int32
+	type upload struct {
+		contentType   string
+		contentLength int64
+		body          []byte
+	}
+	uploads := make(chan upload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// the first attempt fails, the retry reopens the file
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		uploads <- upload{r.Header.Get("Content-Type"), r.ContentLength, body}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithRetry(2, time.Millisecond))
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{"image.png", "image/png"},
+		{"notes.txt", "text/plain; charset=utf-8"},
+		{"empty.json", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		attempts.Store(0)
+		_, err := c.Invoke(context.Background(), http.MethodPut, "/upload", map[string]string{"ignored": "args"}, nil,
+			FileBody(filepath.Join(dir, tt.name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := <-uploads
+		if got.contentType != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got.contentType, tt.contentType)
+		}
+		if got.contentLength != int64(len(files[tt.name])) {
+			t.Errorf("%s: Content-Length = %d, want %d", tt.name, got.contentLength, len(files[tt.name]))
+		}
+		if !bytes.Equal(got.body, files[tt.name]) {
+			t.Errorf("%s: body = %q", tt.name, got.body)
+		}
+	}
+
+	_, err := c.Invoke(context.Background(), http.MethodPut, "/upload", nil, nil, FileBody(filepath.Join(dir, "missing")))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Invoke() error = %v, want %v", err, fs.ErrNotExist)
+	}
+	_, err = c.Invoke(context.Background(), http.MethodPut, "/upload", nil, nil, FileBody(dir))
+	if err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Invoke() error = %v, want not a regular file", err)
+	}
+}
+
+func TestFileBody_ClosedOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+	}))
+	defer srv.Close()
+
+	errSign := errors.New("sign")
+	var body io.ReadCloser
+	c := NewClient(WithEndpoint(srv.URL))
+	_, err := c.Invoke(context.Background(), http.MethodPut, "/upload", nil, nil,
+		FileBody(path),
+		Before(func(request *http.Request) error {
+			body = request.Body
+			return nil
+		}),
+		SignQuery("sign", func(url.Values) (string, error) { return "", errSign }),
+	)
+	if !errors.Is(err, errSign) {
+		t.Fatalf("Invoke() error = %v, want %v", err, errSign)
+	}
+	if sent.Load() != 0 {
+		t.Error("request sent")
+	}
+	if _, err = body.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Read() of the file body error = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestDownloadToFile(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 10<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			_, _ = w.Write(payload)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/slow":
+			w.Header().Set("Content-Length", "1024")
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(200*time.Millisecond))
+
+	dest := filepath.Join(dir, "a", "b", "file.bin")
+	if err := c.DownloadToFile(context.Background(), "/file", dest); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("file has %d bytes, want %d", len(got), len(payload))
+	}
+
+	// a failed download leaves dest as it was and no temporary file
+	err = c.DownloadToFile(context.Background(), "/missing", dest)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound {
+		t.Errorf("DownloadToFile() error = %v, want a 404 *Error", err)
+	}
+	err = c.DownloadToFile(context.Background(), "/slow", dest)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DownloadToFile() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got, _ = os.ReadFile(dest); !bytes.Equal(got, payload) {
+		t.Errorf("file has %d bytes after a failed download, want %d", len(got), len(payload))
+	}
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in %s, want only file.bin", len(entries), filepath.Dir(dest))
+	}
+}
@@ -0,0 +1,109 @@
+package ghttp
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ResponseAwareLimiter is a Limiter that adapts to the responses, the client
+// calls Observe with the status code of every response it receives when the
+// limiter set by WithLimiter implements it.
+type ResponseAwareLimiter interface {
+	Limiter
+	Observe(status int)
+}
+
+// NewSpreadLimiter returns a Limiter that waits for base, then sleeps for a
+// random duration in [0, maxJitter), so that requests admitted at the same
+// time do not reach the server as a burst. base may be nil to only add jitter.
+func NewSpreadLimiter(base Limiter, maxJitter time.Duration) Limiter {
+	return &spreadLimiter{base: base, maxJitter: maxJitter}
+}
+
+type spreadLimiter struct {
+	base      Limiter
+	maxJitter time.Duration
+}
+
+func (s *spreadLimiter) Wait(ctx context.Context) error {
+	if s.base != nil {
+		if err := s.base.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if s.maxJitter <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(s.maxJitter))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// AdaptiveLimiter is a ResponseAwareLimiter that halves its rate on every
+// 429 Too Many Requests and raises it back by a tenth of the maximum rate on
+// every success, the rate stays within [minRate, maxRate] requests per second.
+type AdaptiveLimiter struct {
+	minRate float64
+	maxRate float64
+
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// NewAdaptiveLimiter returns an AdaptiveLimiter starting at maxRate requests
+// per second. It panics if minRate or maxRate is not positive, a minRate above
+// maxRate is lowered to maxRate.
+func NewAdaptiveLimiter(minRate, maxRate float64) *AdaptiveLimiter {
+	// also rejects NaN
+	if !(minRate > 0 && maxRate > 0) {
+		panic(fmt.Sprintf("ghttp: NewAdaptiveLimiter rates must be positive, got %v and %v", minRate, maxRate))
+	}
+	if minRate > maxRate {
+		minRate = maxRate
+	}
+	return &AdaptiveLimiter{minRate: minRate, maxRate: maxRate, rate: maxRate}
+}
+
+// Rate returns the current rate in requests per second.
+func (a *AdaptiveLimiter) Rate() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rate
+}
+
+// Wait blocks until the next request is admitted at the current rate.
+func (a *AdaptiveLimiter) Wait(ctx context.Context) error {
+	a.mu.Lock()
+	now := time.Now()
+	if a.next.Before(now) {
+		a.next = now
+	}
+	at := a.next
+	a.next = a.next.Add(time.Duration(float64(time.Second) / a.rate))
+	a.mu.Unlock()
+
+	return sleep(ctx, systemClock{}, time.Until(at))
+}
+
+// Observe adapts the rate to the status code of a response.
+func (a *AdaptiveLimiter) Observe(status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case status == http.StatusTooManyRequests:
+		a.rate = max(a.rate/2, a.minRate)
+	case status < http.StatusBadRequest:
+		a.rate = min(a.rate+a.maxRate/10, a.maxRate)
+	}
+}
@@ -0,0 +1,155 @@
+package ghttp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countLimiter struct {
+	calls int
+}
+
+func (c *countLimiter) Wait(ctx context.Context) error {
+	c.calls++
+	return nil
+}
+
+func TestSpreadLimiter(t *testing.T) {
+	const maxJitter = 20 * time.Millisecond
+	base := &countLimiter{}
+	l := NewSpreadLimiter(base, maxJitter)
+
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// allow some scheduling latency on top of the jitter
+		if elapsed := time.Since(start); elapsed >= maxJitter+10*time.Millisecond {
+			t.Errorf("Wait() took %s, want < %s", elapsed, maxJitter)
+		}
+	}
+	if base.calls != 10 {
+		t.Errorf("base limiter called %d times, want 10", base.calls)
+	}
+}
+
+func TestSpreadLimiter_Canceled(t *testing.T) {
+	l := NewSpreadLimiter(nil, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := NewAdaptiveLimiter(10, 1000)
+	if got := l.Rate(); got != 1000 {
+		t.Fatalf("Rate() = %v, want 1000", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		l.Observe(http.StatusTooManyRequests)
+	}
+	if got := l.Rate(); got != 125 {
+		t.Errorf("Rate() after 3x429 = %v, want 125", got)
+	}
+	for i := 0; i < 10; i++ {
+		l.Observe(http.StatusTooManyRequests)
+	}
+	if got := l.Rate(); got != 10 {
+		t.Errorf("Rate() = %v, want the minimum 10", got)
+	}
+
+	// 5xx responses do not change the rate
+	l.Observe(http.StatusInternalServerError)
+	if got := l.Rate(); got != 10 {
+		t.Errorf("Rate() after 500 = %v, want 10", got)
+	}
+	for i := 0; i < 20; i++ {
+		l.Observe(http.StatusOK)
+	}
+	if got := l.Rate(); got != 1000 {
+		t.Errorf("Rate() after successes = %v, want the maximum 1000", got)
+	}
+}
+
+func TestAdaptiveLimiter_InvalidRates(t *testing.T) {
+	for _, rates := range [][2]float64{{0, 10}, {1, 0}, {-1, 10}, {1, math.NaN()}, {0, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewAdaptiveLimiter(%v, %v) did not panic", rates[0], rates[1])
+				}
+			}()
+			NewAdaptiveLimiter(rates[0], rates[1])
+		}()
+	}
+
+	// minRate is lowered to maxRate
+	l := NewAdaptiveLimiter(100, 10)
+	l.Observe(http.StatusTooManyRequests)
+	if got := l.Rate(); got != 10 {
+		t.Errorf("Rate() = %v, want 10", got)
+	}
+}
+
+func TestAdaptiveLimiter_Client(t *testing.T) {
+	var tooMany atomic.Bool
+	tooMany.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tooMany.Load() {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	l := NewAdaptiveLimiter(20, 1000)
+	c := NewClient(WithEndpoint(srv.URL), WithLimiter(l))
+
+	// the client feeds the 429s back to the limiter
+	for i := 0; i < 10; i++ {
+		_, _ = c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	}
+	if got := l.Rate(); got != 20 {
+		t.Fatalf("Rate() = %v, want 20", got)
+	}
+
+	// the effective rate dropped to 20/s, 5 requests take at least 200ms
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, _ = c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 requests took %s, want about 200ms", elapsed)
+	}
+
+	tooMany.Store(false)
+	for i := 0; i < 10; i++ {
+		if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.Rate(); got <= 20 {
+		t.Errorf("Rate() after successes = %v, want > 20", got)
+	}
+}
+
+func TestAdaptiveLimiter_Canceled(t *testing.T) {
+	l := NewAdaptiveLimiter(1, 1)
+	_ = l.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,98 @@
+package ghttp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// Multipart is a multipart/form-data request body, a CallOption overriding
+// the args of Invoke:
+//
+//	body := ghttp.NewMultipart().
+//	    Field("name", "acme").
+//	    File("avatar", "avatar.png", f)
+//	client.Invoke(ctx, http.MethodPost, "/users", nil, &reply, body)
+//
+// The parts are written in the order they are added.
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+}
+
+type multipartPart struct {
+	name     string
+	filename string
+	value    string
+	content  io.Reader
+}
+
+// NewMultipart returns an empty multipart/form-data body.
+func NewMultipart() *Multipart {
+	return &Multipart{}
+}
+
+// Field adds a form field.
+func (m *Multipart) Field(name, value string) *Multipart {
+	m.parts = append(m.parts, multipartPart{name: name, value: value})
+	return m
+}
+
+// File adds a file read from content when the request is prepared.
+func (m *Multipart) File(name, filename string, content io.Reader) *Multipart {
+	m.parts = append(m.parts, multipartPart{name: name, filename: filename, content: content})
+	return m
+}
+
+// WithBoundary sets a fixed boundary instead of a random one, so that the
+// body is deterministic, e.g. for golden tests. See
+// (*multipart.Writer).SetBoundary for the valid boundaries.
+func (m *Multipart) WithBoundary(boundary string) *Multipart {
+	m.boundary = boundary
+	return m
+}
+
+// Encode returns the content type, with the boundary, and the body.
+func (m *Multipart) Encode() (string, []byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if m.boundary != "" {
+		if err := w.SetBoundary(m.boundary); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, part := range m.parts {
+		if part.content == nil {
+			if err := w.WriteField(part.name, part.value); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		fw, err := w.CreateFormFile(part.name, part.filename)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err = io.Copy(fw, part.content); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return w.FormDataContentType(), buf.Bytes(), nil
+}
+
+func (m *Multipart) Before(request *http.Request) error {
+	contentType, body, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	request.GetBody = nil
+	return SetRequestBody(request, bytes.NewBuffer(body))
+}
+
+func (m *Multipart) After(response *http.Response) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package ghttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMultipart_Boundary(t *testing.T) {
+	var gotContentType, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	body := NewMultipart().
+		Field("name", "acme").
+		File("avatar", "avatar.txt", strings.NewReader("hello")).
+		WithBoundary("golden")
+
+	c := NewClient(WithEndpoint(srv.URL))
+	if _, err := c.Invoke(context.Background(), http.MethodPost, "/users", nil, nil, body); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "multipart/form-data; boundary=golden"; gotContentType != want {
+		t.Errorf("Content-Type = %q, want %q", gotContentType, want)
+	}
+	want := "--golden\r\n" +
+		"Content-Disposition: form-data; name=\"name\"\r\n" +
+		"\r\n" +
+		"acme\r\n" +
+		"--golden\r\n" +
+		"Content-Disposition: form-data; name=\"avatar\"; filename=\"avatar.txt\"\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"--golden--\r\n"
+	if gotBody != want {
+		t.Errorf("body = %q, want %q", gotBody, want)
+	}
+}
+
+func TestMultipart_RandomBoundary(t *testing.T) {
+	ct1, _, err := NewMultipart().Field("a", "1").Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct2, _, _ := NewMultipart().Field("a", "1").Encode()
+	if ct1 == ct2 {
+		t.Errorf("Encode() content types are equal: %q", ct1)
+	}
+
+	if _, _, err = NewMultipart().WithBoundary("invalid boundary!").Encode(); err == nil {
+		t.Error("Encode() with an invalid boundary: want error")
+	}
+}
@@ -0,0 +1,69 @@
+package ghttp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// ContentTypeMergePatch is the content type of a JSON merge patch, RFC 7386.
+	ContentTypeMergePatch = "application/merge-patch+json"
+	// ContentTypeJSONPatch is the content type of a JSON patch, RFC 6902.
+	ContentTypeJSONPatch = "application/json-patch+json"
+)
+
+// PatchOp is a JSON patch operation, RFC 6902.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value"`
+}
+
+// MarshalJSON leaves out the value of the remove, move and copy operations,
+// which have none, a nil Value of the others is sent as null, e.g. to
+// replace a member with null.
+func (o PatchOp) MarshalJSON() ([]byte, error) {
+	switch o.Op {
+	case "remove", "move", "copy":
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+			From string `json:"from,omitempty"`
+		}{o.Op, o.Path, o.From})
+	}
+	type patchOp PatchOp
+	return json.Marshal(patchOp(o))
+}
+
+// MergePatch sets v as a JSON merge patch request body, overriding the args
+// of Invoke:
+//
+//	client.Invoke(ctx, http.MethodPatch, "users/1", nil, &reply, ghttp.MergePatch(map[string]any{"name": "acme"}))
+func MergePatch(v any) CallOption {
+	return patchCallOption{contentType: ContentTypeMergePatch, body: v}
+}
+
+// JSONPatch sets ops as a JSON patch request body, overriding the args of Invoke:
+//
+//	client.Invoke(ctx, http.MethodPatch, "users/1", nil, &reply, ghttp.JSONPatch([]ghttp.PatchOp{
+//	    {Op: "replace", Path: "/name", Value: "acme"},
+//	}))
+func JSONPatch(ops []PatchOp) CallOption {
+	return patchCallOption{contentType: ContentTypeJSONPatch, body: ops}
+}
+
+type patchCallOption struct {
+	contentType string
+	body        any
+}
+
+func (p patchCallOption) Before(request *http.Request) error {
+	request.Header.Set("Content-Type", p.contentType)
+	request.GetBody = nil
+	return EncodeRequestBody(request, p.body)
+}
+
+func (p patchCallOption) After(response *http.Response) error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package ghttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	var gotContentType, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotContentType = r.Header.Get("Content-Type")
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/merge-patch+json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name            string
+		opt             CallOption
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "merge patch",
+			opt:             MergePatch(map[string]any{"name": "acme", "email": nil}),
+			wantContentType: "application/merge-patch+json",
+			wantBody:        `{"email":null,"name":"acme"}`,
+		},
+		{
+			name: "json patch",
+			opt: JSONPatch([]PatchOp{
+				{Op: "replace", Path: "/name", Value: "acme"},
+				{Op: "replace", Path: "/age", Value: 0},
+				{Op: "remove", Path: "/email"},
+				{Op: "move", From: "/a", Path: "/b"},
+			}),
+			wantContentType: "application/json-patch+json",
+			wantBody: `[{"op":"replace","path":"/name","value":"acme"},{"op":"replace","path":"/age","value":0},` +
+				`{"op":"remove","path":"/email"},{"op":"move","path":"/b","from":"/a"}]`,
+		},
+		{
+			name: "json patch null values",
+			opt: JSONPatch([]PatchOp{
+				{Op: "replace", Path: "/email", Value: nil},
+				{Op: "add", Path: "/phone"},
+				{Op: "test", Path: "/fax", Value: nil},
+				{Op: "copy", From: "/a", Path: "/c"},
+			}),
+			wantContentType: "application/json-patch+json",
+			wantBody: `[{"op":"replace","path":"/email","value":null},{"op":"add","path":"/phone","value":null},` +
+				`{"op":"test","path":"/fax","value":null},{"op":"copy","path":"/c","from":"/a"}]`,
+		},
+	}
+
+	c := NewClient(WithEndpoint(srv.URL))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reply struct {
+				Name string `json:"name"`
+			}
+			if _, err := c.Invoke(context.Background(), http.MethodPatch, "/users/1", nil, &reply, tt.opt); err != nil {
+				t.Fatal(err)
+			}
+			if gotContentType != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", gotContentType, tt.wantContentType)
+			}
+			if gotBody != tt.wantBody {
+				t.Errorf("body = %s, want %s", gotBody, tt.wantBody)
+			}
+			// +json responses are decoded as json
+			if reply.Name != "acme" {
+				t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+			}
+		})
+	}
+}
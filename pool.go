@@ -0,0 +1,99 @@
+package ghttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nexuer/ghttp/encoding"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is not put back, so
+// that a single large body does not pin its memory in the pool.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// pooledBody is a request body marshaled into a buffer of bufferPool.
+//
+// The transport may close the body after RoundTrip returns, and retries or
+// redirects read it again through GetBody, so the buffer is put back once
+// the call and every reader of the body are done, counted by refs. A body
+// that is replaced or never closed, e.g. by a CallOption, is left to the
+// garbage collector.
+type pooledBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+// newPooledBody marshals v into a pooled buffer, the reference of the
+// caller is released with release.
+func newPooledBody(m encoding.BufferMarshaler, v any) (*pooledBody, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := m.MarshalBuffer(buf, v); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	b := &pooledBody{buf: buf}
+	b.refs.Store(1)
+	return b, nil
+}
+
+// reader returns a new reader of the body, the reference is released when
+// it is closed.
+func (b *pooledBody) reader() io.ReadCloser {
+	b.refs.Add(1)
+	return &pooledReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}
+}
+
+// getBody is the GetBody of the request, it fails once the buffer is put
+// back, e.g. for response.Request after Invoke returned.
+func (b *pooledBody) getBody() (io.ReadCloser, error) {
+	for {
+		refs := b.refs.Load()
+		if refs == 0 {
+			return nil, errors.New("request: body released after the call")
+		}
+		if b.refs.CompareAndSwap(refs, refs+1) {
+			return &pooledReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}, nil
+		}
+	}
+}
+
+// release releases a reference, the buffer is put back by the last one.
+// It is a no-op on a nil body.
+func (b *pooledBody) release() {
+	if b == nil {
+		return
+	}
+	if b.refs.Add(-1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+type pooledReader struct {
+	*bytes.Reader
+	body   *pooledBody
+	closed atomic.Bool
+}
+
+func (r *pooledReader) Close() error {
+	if r.closed.CompareAndSwap(false, true) {
+		r.body.release()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package ghttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pooledPayload struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+}
+
+func TestInvoke_PooledBodyConcurrent(t *testing.T) {
+	var failed sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var p pooledPayload
+		if err = json.Unmarshal(body, &p); err != nil {
+			t.Errorf("body %q: %v", body, err)
+		}
+		// the first attempt of every other call fails, the retry reads the
+		// body again through GetBody
+		if strings.HasSuffix(p.ID, "0") {
+			if _, loaded := failed.LoadOrStore(p.ID, true); !loaded {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithRetry(2, time.Millisecond))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				args := pooledPayload{
+					ID:   fmt.Sprintf("%d-%d", g, i),
+					Data: strings.Repeat(fmt.Sprint(g), 100+i*50),
+				}
+				var reply pooledPayload
+				if _, err := c.Invoke(context.Background(), http.MethodPut, "/echo", args, &reply); err != nil {
+					t.Error(err)
+					return
+				}
+				if reply != args {
+					t.Errorf("reply = %+v, want %+v", reply, args)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestInvoke_PooledBodyReleased(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL))
+	response, err := c.Invoke(context.Background(), http.MethodPost, "/", map[string]string{"a": "b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	// the transport may close the body after the call returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err = response.Request.GetBody()
+		if err != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err == nil || !strings.Contains(err.Error(), "body released") {
+		t.Errorf("GetBody() error = %v, want body released", err)
+	}
+
+	// NewRequest does not pool the body, it stays readable
+	req, err := c.NewRequest(context.Background(), http.MethodPost, "/", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ContentLength != int64(len(`{"a":"b"}`)) {
+		t.Errorf("ContentLength = %d", req.ContentLength)
+	}
+	for i := 0; i < 2; i++ {
+		body, err := req.GetBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := io.ReadAll(body); string(data) != `{"a":"b"}` {
+			t.Errorf("body = %q", data)
+		}
+	}
+}
+
+func TestPooledBody_Refs(t *testing.T) {
+	c := NewClient()
+	req, body, err := c.newRequest(context.Background(), http.MethodPost, "/", map[string]int{"n": 1}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body == nil {
+		t.Fatal("body is not pooled")
+	}
+	if req.ContentLength != int64(len(`{"n":1}`)) {
+		t.Errorf("ContentLength = %d", req.ContentLength)
+	}
+
+	rewound, err := req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = req.Body.Close()
+	_ = req.Body.Close() // closing twice releases once
+	body.release()
+	if data, _ := io.ReadAll(rewound); string(data) != `{"n":1}` {
+		t.Errorf("body = %q", data)
+	}
+	if _, err = req.GetBody(); err != nil {
+		t.Errorf("GetBody() error = %v while a reader is open", err)
+	}
+
+	_ = rewound.Close()
+	if got := body.refs.Load(); got != 1 {
+		t.Errorf("refs = %d, want 1", got)
+	}
+}
+
+func BenchmarkNewRequest_Body(b *testing.B) {
+	c := NewClient()
+	args := pooledPayload{ID: "1", Data: strings.Repeat("x", 4096)}
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req, body, err := c.newRequest(context.Background(), http.MethodPost, "/", args, pooled)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = req.Body.Close()
+				body.release()
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package query
+
+import (
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+
+// Unmarshal decodes values into the struct pointed to by v, reversing the
+// struct encoding of Values with the same tags and options:
+//
+//   - slices are read from repeated keys, or from "name[]" with "brackets",
+//     "name0", "name1"... with "numbered" and "name[0]", "name[1]"... with "idx"
+//   - a single value is split on the delimiter of the "comma", "space" or
+//     "semicolon" option, or of the "del" tag, empty segments are kept
+//   - nested structs are read from "scope[name]", or without scope with "inline"
+//   - []byte honors the "base64" and "base64std" options
+//   - bools honor the "yesno" and "onoff" options
+//   - time.Time honors the "epoch" tag, "unix", "unixmilli", "unixmicro",
+//     "unixnano" and the "layout" tag, and defaults to RFC 3339
+//   - types implementing encoding.TextUnmarshaler decode themselves
+//
+// Fields without a value are left unchanged, an empty value sets the zero
+// value. Maps are not supported.
+func Unmarshal(values url.Values, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("query: Unmarshal expects a non-nil pointer")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("query: Unmarshal expects a pointer to struct, got %s", rv.Type())
+	}
+	return unmarshalStruct(values, rv, "", 0)
+}
+
+func unmarshalStruct(values url.Values, val reflect.Value, scope string, count int) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		tag := ""
+		for _, tn := range tags {
+			tag = sf.Tag.Get(tn)
+			if tag != "" {
+				break
+			}
+		}
+		if tag == "-" {
+			continue
+		}
+
+		sv := val.Field(i)
+		fieldName, opts := parseTag(tag, sf)
+		name := fieldName
+		if name == "" {
+			if sf.Anonymous && indirectType(sf.Type).Kind() == reflect.Struct {
+				if sv.Kind() == reflect.Ptr {
+					if !sv.CanSet() {
+						continue
+					}
+					if sv.IsNil() {
+						sv.Set(reflect.New(sf.Type.Elem()))
+					}
+					sv = sv.Elem()
+				}
+				if err := unmarshalStruct(values, sv, scope, count); err != nil {
+					return err
+				}
+				continue
+			}
+			name = sf.Name
+		}
+		if !sv.CanSet() {
+			continue
+		}
+		if scope != "" {
+			name = scope + "[" + name + "]"
+		}
+
+		ft := indirectType(sf.Type)
+		switch {
+		case ft.Kind() == reflect.Struct && ft != timeType && !reflect.PointerTo(ft).Implements(textUnmarshalerType):
+			nextScope := name
+			if fieldName == "" && opts.contains("inline") {
+				if count > 0 {
+					nextScope = scope
+				} else {
+					nextScope = ""
+				}
+			}
+			if !hasScope(values, nextScope) {
+				continue
+			}
+			if err := unmarshalStruct(values, allocate(sv), nextScope, count+1); err != nil {
+				return err
+			}
+		case (ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array) && ft.Elem().Kind() != reflect.Uint8:
+			vs, ok := sliceValues(values, name, sf, opts)
+			if !ok {
+				continue
+			}
+			if err := setSlice(allocate(sv), vs, opts); err != nil {
+				return fmt.Errorf("query: %s: %w", name, err)
+			}
+		default:
+			vs, ok := values[name]
+			if !ok || len(vs) == 0 {
+				continue
+			}
+			if err := setValue(allocate(sv), vs[0], opts); err != nil {
+				return fmt.Errorf("query: %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sliceValues returns the values of a slice field encoded as name.
+func sliceValues(values url.Values, name string, sf reflect.StructField, opts *tagOptions) ([]string, bool) {
+	var del string
+	switch {
+	case opts.contains("comma"):
+		del = ","
+	case opts.contains("space"):
+		del = " "
+	case opts.contains("semicolon"):
+		del = ";"
+	case opts.contains("brackets"):
+		vs, ok := values[name+"[]"]
+		return vs, ok
+	case opts.contains("numbered"), opts.contains("idx"):
+		var vs []string
+		for j := 0; ; j++ {
+			k := fmt.Sprintf("%s%d", name, j)
+			if opts.contains("idx") {
+				k = fmt.Sprintf("%s[%d]", name, j)
+			}
+			v, ok := values[k]
+			if !ok || len(v) == 0 {
+				return vs, len(vs) > 0
+			}
+			vs = append(vs, v[0])
+		}
+	default:
+		del = sf.Tag.Get("del")
+	}
+
+	vs, ok := values[name]
+	if !ok || del == "" {
+		return vs, ok
+	}
+	var split []string
+	for _, v := range vs {
+		split = append(split, strings.Split(v, del)...)
+	}
+	return split, true
+}
+
+func setSlice(v reflect.Value, vs []string, opts *tagOptions) error {
+	if v.Kind() == reflect.Array {
+		for i := 0; i < v.Len() && i < len(vs); i++ {
+			if err := setValue(allocate(v.Index(i)), vs[i], opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+	for i, str := range vs {
+		if err := setValue(allocate(s.Index(i)), str, opts); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// setValue parses s into v, an empty s sets the zero value.
+func setValue(v reflect.Value, s string, opts *tagOptions) error {
+	if s == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	// before TextUnmarshaler, which time.Time implements without the options
+	if v.Type() == timeType {
+		t, err := parseTime(s, opts)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := parseBool(s, opts)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		// []byte
+		b, err := parseBytes(s, opts)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(s))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseBool parses s as encoded with the "yesno" or "onoff" option, or as
+// strconv.ParseBool does.
+func parseBool(s string, opts *tagOptions) (bool, error) {
+	switch {
+	case opts.contains("yesno") && (s == "yes" || s == "no"):
+		return s == "yes", nil
+	case opts.contains("onoff") && (s == "on" || s == "off"):
+		return s == "on", nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// parseBytes decodes s as encoded with the "base64" option, padded or not, or
+// with the "base64std" option, otherwise s is the raw bytes.
+func parseBytes(s string, opts *tagOptions) ([]byte, error) {
+	switch {
+	case opts.contains("base64"):
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	case opts.contains("base64std"):
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return []byte(s), nil
+}
+
+// epochTimes reverse epochUnits.
+var epochTimes = map[string]func(int64) time.Time{
+	"s":  func(n int64) time.Time { return time.Unix(n, 0) },
+	"ms": time.UnixMilli,
+	"us": time.UnixMicro,
+	"ns": func(n int64) time.Time { return time.Unix(0, n) },
+}
+
+func parseTime(s string, opts *tagOptions) (time.Time, error) {
+	parseInt := func() (int64, error) { return strconv.ParseInt(s, 10, 64) }
+	if opts != nil {
+		if f, ok := epochTimes[opts.epoch]; ok {
+			n, err := parseInt()
+			return f(n), err
+		}
+	}
+	switch {
+	case opts.contains("unix"):
+		n, err := parseInt()
+		return time.Unix(n, 0), err
+	case opts.contains("unixmilli"):
+		n, err := parseInt()
+		return time.UnixMilli(n), err
+	case opts.contains("unixmicro"):
+		n, err := parseInt()
+		return time.UnixMicro(n), err
+	case opts.contains("unixnano"):
+		n, err := parseInt()
+		return time.Unix(0, n), err
+	}
+	if opts != nil {
+		if layout := opts.layout; layout != "" {
+			return time.Parse(layout, s)
+		}
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// allocate dereferences v, allocating nil pointers.
+func allocate(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// hasScope reports whether a key of values is scoped by scope.
+func hasScope(values url.Values, scope string) bool {
+	if scope == "" {
+		return true
+	}
+	for k := range values {
+		if strings.HasPrefix(k, scope+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValuesToMap converts values into a nested map, reversing the scoping of
+// Values. Both bracket and dot notation are supported:
+//
+//	"a[b][c]=1"        => map[string]any{"a": map[string]any{"b": map[string]any{"c": "1"}}}
+//	"a.b.c=1"          => map[string]any{"a": map[string]any{"b": map[string]any{"c": "1"}}}
+//	"a[]=1"            => map[string]any{"a": []string{"1"}}
+//	"a=1&a=2"          => map[string]any{"a": []string{"1", "2"}}
+//
+// A key with a single value maps to a string, with multiple values or a
+// trailing "[]" to a []string. If a key is used both as a value and as a
+// scope, such as "a=1&a[b]=2", the nested map wins.
+func ValuesToMap(values url.Values) map[string]any {
+	result := make(map[string]any)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	// a key sorts before its scopes, so that scopes replace plain values deterministically
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vs := values[key]
+		path, isSlice := splitKey(key)
+		if len(path) == 0 {
+			continue
+		}
+
+		m := result
+		for _, name := range path[:len(path)-1] {
+			next, ok := m[name].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				m[name] = next
+			}
+			m = next
+		}
+
+		last := path[len(path)-1]
+		if _, ok := m[last].(map[string]any); ok {
+			continue
+		}
+		if isSlice || len(vs) > 1 {
+			m[last] = append([]string(nil), vs...)
+		} else if len(vs) == 1 {
+			m[last] = vs[0]
+		} else {
+			m[last] = ""
+		}
+	}
+	return result
+}
+
+// splitKey splits "a[b][c]" or "a.b.c" into its path, isSlice reports a trailing "[]".
+func splitKey(key string) (path []string, isSlice bool) {
+	if strings.HasSuffix(key, "[]") {
+		isSlice = true
+		key = strings.TrimSuffix(key, "[]")
+	}
+
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			path = append(path, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '[', ']', '.':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return path, isSlice
+}
@@ -0,0 +1,372 @@
+package query
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValuesToMap(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]any
+	}{
+		// zero values
+		{input: "", want: map[string]any{}},
+
+		// simple values
+		{input: "a=1&b=2", want: map[string]any{"a": "1", "b": "2"}},
+		{input: "a=1&a=2", want: map[string]any{"a": []string{"1", "2"}}},
+		{input: "a=", want: map[string]any{"a": ""}},
+
+		// bracket notation
+		{
+			input: "user[name]=acme&user[addr][city]=SFO&user[addr][postcode]=1234",
+			want: map[string]any{
+				"user": map[string]any{
+					"name": "acme",
+					"addr": map[string]any{"city": "SFO", "postcode": "1234"},
+				},
+			},
+		},
+		{input: "a[]=1", want: map[string]any{"a": []string{"1"}}},
+		{input: "a[b][]=1&a[b][]=2", want: map[string]any{"a": map[string]any{"b": []string{"1", "2"}}}},
+		{input: "a[0]=x&a[1]=y", want: map[string]any{"a": map[string]any{"0": "x", "1": "y"}}},
+
+		// dot notation
+		{
+			input: "user.name=acme&user.addr.city=SFO",
+			want: map[string]any{
+				"user": map[string]any{
+					"name": "acme",
+					"addr": map[string]any{"city": "SFO"},
+				},
+			},
+		},
+
+		// mixed notation
+		{input: "a.b[c]=1", want: map[string]any{"a": map[string]any{"b": map[string]any{"c": "1"}}}},
+
+		// scope wins over plain value
+		{input: "a=1&a[b]=2", want: map[string]any{"a": map[string]any{"b": "2"}}},
+	}
+
+	for _, tt := range tests {
+		values, err := url.ParseQuery(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, ValuesToMap(values)); diff != "" {
+			t.Errorf("ValuesToMap(%q) mismatch:\n%s", tt.input, diff)
+		}
+	}
+}
+
+func TestValuesToMap_RoundTrip(t *testing.T) {
+	input := map[string]any{
+		"user": map[string]any{
+			"name": "acme",
+			"addr": map[string]any{"city": "SFO"},
+		},
+	}
+	values, err := Values(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(input, ValuesToMap(values)); diff != "" {
+		t.Errorf("ValuesToMap(Values()) mismatch:\n%s", diff)
+	}
+}
+
+func TestUnmarshal_DelimitedSlices(t *testing.T) {
+	type params struct {
+		Comma     []string `query:"comma,comma"`
+		Semicolon []string `query:"semicolon,semicolon"`
+		Space     []int    `query:"space,space"`
+		Del       []bool   `query:"del,int" del:"!"`
+		Brackets  []string `query:"brackets,brackets"`
+		Idx       []string `query:"idx,idx"`
+		Numbered  []string `query:"numbered,numbered"`
+		Repeated  []string `query:"repeated"`
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  params
+	}{
+		{
+			name:  "comma",
+			query: "comma=a,b,c",
+			want:  params{Comma: []string{"a", "b", "c"}},
+		},
+		{
+			name:  "semicolon",
+			query: "semicolon=a%3Bb",
+			want:  params{Semicolon: []string{"a", "b"}},
+		},
+		{
+			name:  "empty segments",
+			query: "comma=a,,b,",
+			want:  params{Comma: []string{"a", "", "b", ""}},
+		},
+		{
+			name:  "single empty value",
+			query: "comma=",
+			want:  params{Comma: []string{""}},
+		},
+		{
+			name:  "space and del",
+			query: "space=1+2+3&del=1!0!1",
+			want:  params{Space: []int{1, 2, 3}, Del: []bool{true, false, true}},
+		},
+		{
+			name:  "brackets idx numbered repeated",
+			query: "brackets[]=a&brackets[]=b&idx[0]=c&idx[1]=d&numbered0=e&numbered1=f&repeated=g&repeated=h",
+			want: params{
+				Brackets: []string{"a", "b"},
+				Idx:      []string{"c", "d"},
+				Numbered: []string{"e", "f"},
+				Repeated: []string{"g", "h"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got params
+			if err := Unmarshal(values, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Unmarshal(%q) mismatch:\n%s", tt.query, diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_RoundTrip(t *testing.T) {
+	type addr struct {
+		City     string `query:"city"`
+		Postcode *int   `query:"postcode"`
+	}
+	type params struct {
+		Name    string    `query:"name"`
+		Age     uint8     `query:"age"`
+		Score   float64   `query:"score"`
+		Active  bool      `query:"active,int"`
+		Tags    []string  `query:"tags,comma"`
+		Empty   []string  `query:"empty,comma"`
+		Created time.Time `query:"created,unix"`
+		Day     time.Time `query:"day" layout:"2006-01-02"`
+		Addr    *addr     `query:"addr"`
+		Skip    string    `query:"-"`
+	}
+
+	postcode := 1234
+	in := params{
+		Name:    "acme",
+		Age:     18,
+		Score:   9.5,
+		Active:  true,
+		Tags:    []string{"a", "b"},
+		Empty:   []string{""},
+		Created: time.Unix(1700000000, 0),
+		Day:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Addr:    &addr{City: "SFO", Postcode: &postcode},
+		Skip:    "skip",
+	}
+	values, err := Values(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out params
+	if err := Unmarshal(values, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skip = ""
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("Unmarshal(Values()) mismatch:\n%s", diff)
+	}
+}
+
+func TestUnmarshal_Epoch(t *testing.T) {
+	type params struct {
+		Unix      time.Time `query:"unix,unix"`
+		UnixMilli time.Time `query:"unixmilli,unixmilli"`
+		UnixMicro time.Time `query:"unixmicro,unixmicro"`
+		UnixNano  time.Time `query:"unixnano,unixnano"`
+		S         time.Time `query:"s" epoch:"s"`
+		MS        time.Time `query:"ms" epoch:"ms"`
+		US        time.Time `query:"us" epoch:"us"`
+		NS        time.Time `query:"ns" epoch:"ns"`
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	in := params{
+		Unix:      ts.Truncate(time.Second),
+		UnixMilli: ts.Truncate(time.Millisecond),
+		UnixMicro: ts.Truncate(time.Microsecond),
+		UnixNano:  ts,
+		S:         ts.Truncate(time.Second),
+		MS:        ts.Truncate(time.Millisecond),
+		US:        ts.Truncate(time.Microsecond),
+		NS:        ts,
+	}
+	values, err := Values(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values.Get("us"); got != "1704164645123456" {
+		t.Errorf("us = %q, want %q", got, "1704164645123456")
+	}
+
+	var out params
+	if err := Unmarshal(values, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("Unmarshal(Values()) mismatch:\n%s", diff)
+	}
+}
+
+func TestUnmarshal_Bool(t *testing.T) {
+	type params struct {
+		Default bool   `query:"default"`
+		Int     bool   `query:"int,int"`
+		YesNo   bool   `query:"yesno,yesno"`
+		OnOff   bool   `query:"onoff,onoff"`
+		YesNos  []bool `query:"yesnos,yesno,comma"`
+		OnOffs  []bool `query:"onoffs,onoff"`
+	}
+
+	in := params{
+		Default: true,
+		Int:     true,
+		YesNo:   true,
+		OnOff:   true,
+		YesNos:  []bool{true, false},
+		OnOffs:  []bool{false, true},
+	}
+	values, err := Values(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values.Get("yesno"); got != "yes" {
+		t.Errorf("yesno = %q, want %q", got, "yes")
+	}
+
+	var out params
+	if err := Unmarshal(values, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("Unmarshal(Values()) mismatch:\n%s", diff)
+	}
+
+	var s struct {
+		B bool `query:"b"`
+	}
+	if err := Unmarshal(url.Values{"b": {"yes"}}, &s); err == nil {
+		t.Error("Unmarshal() of yes without yesno: error = nil")
+	}
+}
+
+func TestUnmarshal_Base64(t *testing.T) {
+	type params struct {
+		URL []byte `query:"url,base64"`
+		Std []byte `query:"std,base64std"`
+	}
+
+	in := params{
+		URL: []byte{0xfb, 0xff, 0x01},
+		Std: []byte{0xfb, 0xff, 0x01},
+	}
+	values, err := Values(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values.Encode(), "std=%2B%2F8B&url=-_8B"; got != want {
+		t.Errorf("Values() = %q, want %q", got, want)
+	}
+
+	var out params
+	if err := Unmarshal(values, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("Unmarshal(Values()) mismatch:\n%s", diff)
+	}
+
+	// padding is accepted with base64
+	var s struct {
+		D []byte `query:"d,base64"`
+	}
+	if err := Unmarshal(url.Values{"d": {"aGk="}}, &s); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.D) != "hi" {
+		t.Errorf("D = %q, want %q", s.D, "hi")
+	}
+	if err := Unmarshal(url.Values{"d": {"not base64!"}}, &s); err == nil {
+		t.Error("Unmarshal() of invalid base64: error = nil")
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	var s struct {
+		N int `query:"n"`
+	}
+	if err := Unmarshal(url.Values{"n": {"abc"}}, &s); err == nil {
+		t.Error("Unmarshal() of an invalid int: error = nil")
+	}
+	if err := Unmarshal(url.Values{}, s); err == nil {
+		t.Error("Unmarshal() of a non-pointer: error = nil")
+	}
+}
+
+func TestValues_ReservedMapKeys(t *testing.T) {
+	// dots and percent signs are kept as they are
+	values, err := Values(map[string]any{
+		"filter": map[string]any{
+			"author.name": "x",
+			"100%":        "4",
+			"plain":       "5",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"filter[author.name]": {"x"},
+		"filter[100%]":        {"4"},
+		"filter[plain]":       {"5"},
+	}
+	if diff := cmp.Diff(want, values); diff != "" {
+		t.Errorf("Values() mismatch:\n%s", diff)
+	}
+
+	// brackets would be read as scoping
+	for _, key := range []string{"a]b", "c[d", "[e]"} {
+		_, err = Values(map[string]any{"m": map[string]string{key: "1"}})
+		if err == nil || !strings.Contains(err.Error(), "map key") {
+			t.Errorf("Values() of key %q: error = %v, want a map key error", key, err)
+		}
+	}
+
+	// top-level keys are not scoped and are kept
+	values, err = Values(map[string]string{"filter[a]": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(url.Values{"filter[a]": {"1"}}, values); diff != "" {
+		t.Errorf("Values() mismatch:\n%s", diff)
+	}
+}
@@ -2,11 +2,16 @@ package query
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,8 +35,22 @@ type Encoder interface {
 	EncodeValues(key string, v *url.Values) error
 }
 
+var queryValuerType = reflect.TypeOf(new(QueryValuer)).Elem()
+
+// QueryValuer is an interface implemented by a struct passed to Values that
+// adds computed parameters, e.g. a signature over its other fields, to the
+// values of its fields. It only applies to the struct passed to Values, not
+// to nested structs.
+type QueryValuer interface {
+	QueryValues() (url.Values, error)
+}
+
 var timeType = reflect.TypeOf(time.Time{})
 
+var valuerType = reflect.TypeOf(new(driver.Valuer)).Elem()
+
+var urlValuesType = reflect.TypeOf(url.Values{})
+
 // Values returns the url.Values encoding of v.
 //
 // Values expects to be passed a struct, string, map, array, or slice,
@@ -51,7 +70,12 @@ var timeType = reflect.TypeOf(time.Time{})
 //
 // The empty values are false, 0, any nil pointer or interface value, any array
 // slice, map, or string of length zero, and any type (such as time.Time) that
-// returns true for IsZero().
+// returns true for IsZero(). Types implementing Emptier decide for themselves
+// via IsEmpty(), which takes precedence over the rules above.
+//
+// A non-nil pointer is not empty, even to a zero value: with omitempty, a
+// *int, *float64 or *bool field sends an explicit 0 or false when set, and is
+// omitted when nil.
 //
 // The URL parameter name defaults to the struct field name but can be
 // specified in the struct field's tag value.  The "query" key in the struct
@@ -77,19 +101,27 @@ var timeType = reflect.TypeOf(time.Time{})
 //
 // Boolean values default to encoding as the strings "true" or "false".
 // Including the "int" option signals that the field should be encoded as the
-// strings "1" or "0".
+// strings "1" or "0", "yesno" as "yes" or "no" and "onoff" as "on" or "off".
 //
 // time.Time values default to encoding as RFC3339 timestamps.  Including the
 // "unix" option signals that the field should be encoded as a Unix time (see
-// time.Unix()).  The "unixmilli" and "unixnano" options will encode the number
-// of milliseconds and nanoseconds, respectively, since January 1, 1970 (see
-// time.UnixNano()).  Including the "layout" struct tag (separate from the
-// "query" tag) will use the value of the "layout" tag as a layout passed to
-// time.Format.  For example:
+// time.Unix()).  The "unixmilli", "unixmicro" and "unixnano" options will
+// encode the number of milliseconds, microseconds and nanoseconds,
+// respectively, since January 1, 1970 (see time.UnixNano()).  The "epoch"
+// struct tag sets the unit explicitly, one of "s", "ms", "us" or "ns", and
+// takes precedence over the options.  Including the "layout" struct tag
+// (separate from the "query" tag) will use the value of the "layout" tag as a
+// layout passed to time.Format.  For example:
 //
 //	// Encode a time.Time as YYYY-MM-DD HH:ii:ss
 //	Field time.Time `layout:"2006-01-02 15:04:05"`
 //
+//	// Encode a time.Time as microseconds since January 1, 1970
+//	Field time.Time `epoch:"us"`
+//
+// These options also apply to the time.Time or *time.Time values of a map
+// or slice field, e.g. map[string]*time.Time.
+//
 // Slice and Array values default to encoding as multiple URL values of the
 // same name.  Including the "comma" option signals that the field should be
 // encoded as a single comma-delimited value.  Including the "space" option
@@ -98,7 +130,12 @@ var timeType = reflect.TypeOf(time.Time{})
 // Including the "brackets" option signals that the multiple URL values should
 // have "[]" appended to the value name. "numbered" will append a number to
 // the end of each incidence of the value name, example:
-// name0=value0&name1=value1, etc.  Including the "del" struct tag (separate
+// name0=value0&name1=value1, etc. "idx" will append the index in brackets,
+// for PHP/Rails style arrays, consistently for slices of scalars and of
+// structs or maps, example: name[0]=value0&name[1]=value1 and
+// name[0][key]=value0&name[1][key]=value1. With "collapse", a single element
+// is encoded as a scalar in every mode, e.g. name=value0 rather than
+// name[]=value0.  Including the "del" struct tag (separate
 // from the "query" tag) will use the value of the "del" tag as the delimiter.
 // For example:
 //
@@ -111,7 +148,42 @@ var timeType = reflect.TypeOf(time.Time{})
 // visibility rules.  An anonymous struct field with a name given in its URL
 // tag is treated as having that name, rather than being anonymous.
 //
-// Non-nil pointer values are encoded as the value pointed to.
+// Non-nil pointer values are encoded as the value pointed to, a nil pointer
+// as a single empty value. Including the "expandnil" option encodes a nil
+// pointer to struct as its zero value instead, e.g. "nest[b][value]=" rather
+// than "nest[b]=". Interface
+// values are encoded as their dynamic value, so an any field holding a
+// struct, a pointer to struct or a map is scoped like a nested field.
+//
+// Values implementing driver.Valuer, such as sql.NullString or sql.NullInt64,
+// are encoded as the value returned by their Value method, and omitted if
+// that value is nil (e.g. an invalid sql.NullString).
+//
+// Including the "string" option encodes a value implementing fmt.Stringer,
+// e.g. a struct, as its String() rather than recursing into its fields:
+//
+//	// Field appears as URL parameter "version=1.2.3" instead of
+//	// "version[major]=1&version[minor]=2&version[patch]=3"
+//	Field Version `query:"version,string"`
+//
+// String values, including the elements of a slice, can be case-folded with
+// the "lower" and "upper" options, e.g. for enums:
+//
+//	// Field appears as URL parameter "state=open"
+//	Field State `query:"state,lower"`
+//
+// A []byte field is a slice of numbers, each byte encoded as a repeated
+// value, and a raw string where it is encoded as a single value, neither is
+// safe for binary data. Including the "base64" option encodes it as a single
+// unpadded base64url value (see base64.RawURLEncoding), "base64std" as a
+// padded standard base64 value:
+//
+//	// Field appears as URL parameter "token=-_8"
+//	Field []byte `query:"token,base64"`
+//
+// A url.Values field has its pairs scoped under the field name, each value as
+// a repeated parameter, e.g. "filter[status]=open&filter[label]=a&filter[label]=b".
+// With the "inline" option the pairs are added as-is: "status=open&label=a&label=b".
 //
 // Nested structs have their fields processed recursively and are encoded
 // including parent fields in value names for scoping. For example,
@@ -122,10 +194,19 @@ var timeType = reflect.TypeOf(time.Time{})
 //
 //	"name=acme&addr[postcode]=1234&addr[city]=SFO"
 //
+// Inline structs and maps share the scope of their parent at any depth, a nil
+// inline pointer adds no parameter.
+//
+// The keys of nested maps are scoped as they are, a key containing "[" or
+// "]", such as "a]b", would be ambiguous and returns an error.
+//
 // All other values are encoded using their default string representation.
 //
 // Multiple fields that encode to the same URL parameter name will be included
 // as multiple URL values of the same name.
+//
+// A struct implementing QueryValuer has the values of its QueryValues method
+// added after those of its fields.
 func Values(v interface{}) (url.Values, error) {
 	values := make(url.Values)
 
@@ -154,50 +235,211 @@ func Values(v interface{}) (url.Values, error) {
 	return values, err
 }
 
+// ValuesStrict is like Values but returns an error if v is nil or a nil
+// pointer, which Values silently encodes as empty values, or if a struct
+// field has a tag that Values ignores: "layout" or "epoch" on a field that is
+// not a time.Time, or a slice, array or map of time.Time, an unknown "epoch"
+// unit, and "del" on a field that is not a slice or array.
+func ValuesStrict(v interface{}) (url.Values, error) {
+	if v == nil {
+		return nil, errors.New("query: ValuesStrict() nil input")
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, fmt.Errorf("query: ValuesStrict() nil pointer input. Got %v", reflect.TypeOf(v))
+		}
+		val = val.Elem()
+	}
+	if err := validateTags(val.Type(), make(map[reflect.Type]bool)); err != nil {
+		return nil, err
+	}
+	return Values(v)
+}
+
+// validateTags checks the "layout" and "del" tags of the fields of typ and of
+// the structs it contains, seen guards recursive types.
+func validateTags(typ reflect.Type, seen map[reflect.Type]bool) error {
+	typ = indirectType(typ)
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return validateTags(typ.Elem(), seen)
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	if typ == timeType || seen[typ] {
+		return nil
+	}
+	seen[typ] = true
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		if tagValue(sf) == "-" {
+			continue
+		}
+
+		ft := indirectType(sf.Type)
+		if sf.Tag.Get("layout") != "" && elemType(ft) != timeType {
+			return fmt.Errorf("query: ValuesStrict() layout tag on non-time field %s.%s. Got %v", typ, sf.Name, sf.Type)
+		}
+		if unit := sf.Tag.Get("epoch"); unit != "" {
+			if elemType(ft) != timeType {
+				return fmt.Errorf("query: ValuesStrict() epoch tag on non-time field %s.%s. Got %v", typ, sf.Name, sf.Type)
+			}
+			if _, ok := epochUnits[unit]; !ok {
+				return fmt.Errorf("query: ValuesStrict() unknown epoch unit %q of field %s.%s", unit, typ, sf.Name)
+			}
+		}
+		if sf.Tag.Get("del") != "" && ft.Kind() != reflect.Slice && ft.Kind() != reflect.Array {
+			return fmt.Errorf("query: ValuesStrict() del tag on non-slice field %s.%s. Got %v", typ, sf.Name, sf.Type)
+		}
+		if err := validateTags(ft, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elemType returns the element type of the slices, arrays, maps and pointers
+// of t.
+func elemType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// EncodePercent encodes the values into "URL encoded" form like
+// url.Values.Encode, sorted by key, but escapes spaces as "%20" instead of "+",
+// for servers that do not decode "+" as a space.
+func EncodePercent(v url.Values) string {
+	if len(v) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		keyEscaped := percentEscape(k)
+		for _, val := range v[k] {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(keyEscaped)
+			buf.WriteByte('=')
+			buf.WriteString(percentEscape(val))
+		}
+	}
+	return buf.String()
+}
+
+// percentEscape escapes s like url.QueryEscape, with spaces as "%20".
+// QueryEscape escapes a literal "+" as "%2B", so any "+" left is a space.
+func percentEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// valueAdder is the destination of the encoded values, url.Values or *OrderedValues.
+type valueAdder interface {
+	Add(key, value string)
+}
+
+// encodeValues calls the custom Encoder, keeping the order of the values
+// it adds when encoding into OrderedValues.
+func encodeValues(values valueAdder, m Encoder, name string) error {
+	if uv, ok := values.(url.Values); ok {
+		return m.EncodeValues(name, &uv)
+	}
+	uv := make(url.Values)
+	if err := m.EncodeValues(name, &uv); err != nil {
+		return err
+	}
+	for _, kv := range orderedFromValues(uv) {
+		values.Add(kv.Key, kv.Value)
+	}
+	return nil
+}
+
 func parseQueryString(queryString string) (url.Values, error) {
 	return url.ParseQuery(strings.TrimLeft(queryString, "?"))
 }
 
-func reflectValue(values url.Values, val reflect.Value) error {
+func reflectValue(values valueAdder, val reflect.Value) error {
 	switch val.Kind() {
 	case reflect.Map:
 		return reflectMap(values, val, "", 0, nil)
 	case reflect.Slice, reflect.Array:
 		return reflectSlice(values, val, "", 0, nil)
 	case reflect.Struct:
-		return reflectStruct(values, val, "", 0)
+		if err := reflectStruct(values, val, "", 0); err != nil {
+			return err
+		}
+		return addQueryValues(values, val)
 	default:
 		return fmt.Errorf("query: Values() unsupported kind input. Got %v", val.Kind())
 	}
 }
 
+// addQueryValues adds the QueryValues of val if val or a pointer to val
+// implements QueryValuer, sorted by key.
+func addQueryValues(values valueAdder, val reflect.Value) error {
+	var qv QueryValuer
+	switch {
+	case val.Type().Implements(queryValuerType):
+		qv = val.Interface().(QueryValuer)
+	case reflect.PointerTo(val.Type()).Implements(queryValuerType):
+		if val.CanAddr() {
+			qv = val.Addr().Interface().(QueryValuer)
+		} else {
+			p := reflect.New(val.Type())
+			p.Elem().Set(val)
+			qv = p.Interface().(QueryValuer)
+		}
+	default:
+		return nil
+	}
+
+	computed, err := qv.QueryValues()
+	if err != nil {
+		return err
+	}
+	for _, kv := range orderedFromValues(computed) {
+		values.Add(kv.Key, kv.Value)
+	}
+	return nil
+}
+
 // reflectValue populates the values parameter from the struct fields in val.
 // Embedded structs are followed recursively (using the rules defined in the
 // Values function documentation) breadth-first.
-func reflectStruct(values url.Values, val reflect.Value, scope string, count int) error {
-	var embedded []reflect.Value
-
-	typ := val.Type()
-	for i := 0; i < typ.NumField(); i++ {
-		sf := typ.Field(i)
-		if sf.PkgPath != "" && !sf.Anonymous { // unexported
-			continue
-		}
-		// reset tag
-		tag := ""
-		for _, tn := range tags {
-			tag = sf.Tag.Get(tn)
-			if tag != "" {
-				break
-			}
-		}
+func reflectStruct(values valueAdder, val reflect.Value, scope string, count int) error {
+	fields := cachedFields(val.Type())
+	if fields.flat != nil {
+		// fast path, see flatFields
+		encodeFlat(values, val, scope, fields.flat)
+		return nil
+	}
+	return reflectFields(values, val, scope, count, fields.list)
+}
 
-		if tag == "-" {
-			continue
-		}
+// reflectFields populates the values parameter from the fields of val.
+func reflectFields(values valueAdder, val reflect.Value, scope string, count int, fields []field) error {
+	var embedded []reflect.Value
 
-		sv := val.Field(i)
-		fieldName, opts := parseTag(tag, sf)
+	for _, f := range fields {
+		sf, fieldName, opts := f.sf, f.name, f.opts
+		sv := val.Field(f.index)
 		name := fieldName
 		if name == "" {
 			if sf.Anonymous {
@@ -220,6 +462,16 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 			continue
 		}
 
+		// encode the dynamic value of an interface, e.g. an any field holding
+		// a struct, a pointer to struct or a map
+		if sv.Kind() == reflect.Interface {
+			if sv.IsNil() {
+				values.Add(name, "")
+				continue
+			}
+			sv = sv.Elem()
+		}
+
 		if sv.Type().Implements(encoderType) {
 			// if sv is a nil pointer and the custom encoder is defined on a non-pointer
 			// method receiver, set sv to the zero value of the underlying type
@@ -228,17 +480,31 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 			}
 
 			m := sv.Interface().(Encoder)
-			if err := m.EncodeValues(name, &values); err != nil {
+			if err := encodeValues(values, m, name); err != nil {
 				return err
 			}
 			continue
 		}
 
-		// recursively dereference pointers. break on nil pointers
-		if sv.Kind() == reflect.Interface {
-			sv = sv.Elem()
+		if dv, ok, err := driverValue(sv); ok {
+			if err != nil {
+				return err
+			}
+			if dv.IsValid() {
+				values.Add(name, valueString(dv, opts))
+			}
+			continue
 		}
 
+		// query:"name,string" encodes a fmt.Stringer, e.g. a struct, as String()
+		if opts.contains("string") {
+			if str, ok := stringerValue(sv); ok {
+				values.Add(name, str)
+				continue
+			}
+		}
+
+		// recursively dereference pointers. break on nil pointers
 		for sv.Kind() == reflect.Ptr {
 			if sv.IsNil() {
 				break
@@ -246,12 +512,45 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 			sv = sv.Elem()
 		}
 
+		// query:"name,expandnil" encodes a nil pointer to struct as the zero struct
+		if sv.Kind() == reflect.Ptr && opts.contains("expandnil") {
+			if elem := indirectType(sv.Type()); elem.Kind() == reflect.Struct && elem != timeType {
+				sv = reflect.New(elem).Elem()
+			}
+		}
+
+		// an inline nil pointer to struct or map has no fields to flatten, its
+		// field name is not a parameter of the enclosing scope
+		if sv.Kind() == reflect.Ptr && fieldName == "" && opts.contains("inline") {
+			if elem := indirectType(sv.Type()); (elem.Kind() == reflect.Struct && elem != timeType) || elem.Kind() == reflect.Map {
+				continue
+			}
+		}
+
 		// handle special types
 		if sv.Type() == timeType {
 			values.Add(name, valueString(sv, opts))
 			continue
 		}
 
+		// query:"name,base64" encodes a []byte as a single base64 value
+		if sv.Kind() == reflect.Slice && sv.Type().Elem().Kind() == reflect.Uint8 &&
+			(opts.contains("base64") || opts.contains("base64std")) {
+			values.Add(name, valueString(sv, opts))
+			continue
+		}
+
+		if sv.Type() == urlValuesType {
+			nextScope := name
+			if fieldName == "" && opts.contains("inline") {
+				nextScope = scope
+			}
+			if err := addURLValues(values, sv.Interface().(url.Values), nextScope); err != nil {
+				return err
+			}
+			continue
+		}
+
 		switch sv.Kind() {
 		case reflect.Slice, reflect.Array:
 			l := sv.Len()
@@ -260,6 +559,9 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 				continue
 			}
 
+			// query:"name,collapse" encodes a single element as a scalar
+			collapse := l == 1 && opts.contains("collapse")
+
 			var del string
 			if opts.contains("comma") {
 				del = ","
@@ -268,9 +570,11 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 			} else if opts.contains("semicolon") {
 				del = ";"
 			} else if opts.contains("brackets") {
-				name = name + "[]"
+				if !collapse {
+					name = name + "[]"
+				}
 			} else {
-				del = sf.Tag.Get("del")
+				del = opts.del
 			}
 
 			if del != "" {
@@ -289,7 +593,9 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 			} else {
 				for j := 0; j < l; j++ {
 					k := name
-					if opts.contains("numbered") {
+					if collapse {
+						// keep the plain name
+					} else if opts.contains("numbered") {
 						k = fmt.Sprintf("%s%d", name, j)
 					} else if opts.contains("idx") {
 						k = fmt.Sprintf("%s[%d]", name, j)
@@ -306,13 +612,10 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 				}
 			}
 		case reflect.Map, reflect.Struct:
+			// an inline field shares the scope of its struct, at any depth
 			nextScope := name
-			if ok := opts.contains("inline"); fieldName == "" && ok {
-				if count > 0 {
-					nextScope = scope
-				} else {
-					nextScope = ""
-				}
+			if fieldName == "" && opts.contains("inline") {
+				nextScope = scope
 			}
 			if sv.Kind() == reflect.Map {
 				if err := reflectMap(values, sv, nextScope, count+1, opts); err != nil {
@@ -338,13 +641,65 @@ func reflectStruct(values url.Values, val reflect.Value, scope string, count int
 	return nil
 }
 
+var stringerType = reflect.TypeOf(new(fmt.Stringer)).Elem()
+
+// stringerValue returns the String() of v if v or a pointer to v implements
+// fmt.Stringer, ok is false otherwise. A nil pointer is "".
+func stringerValue(v reflect.Value) (string, bool) {
+	if v.Type().Implements(stringerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", true
+		}
+		return v.Interface().(fmt.Stringer).String(), true
+	}
+	if v.Kind() != reflect.Ptr && reflect.PointerTo(v.Type()).Implements(stringerType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface().(fmt.Stringer).String(), true
+	}
+	return "", false
+}
+
+// driverValue returns the value of v if it implements driver.Valuer, ok is false
+// otherwise. The returned value is invalid if the Valuer returns nil,
+// e.g. sql.NullString with Valid set to false.
+func driverValue(v reflect.Value) (dv reflect.Value, ok bool, err error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.Type().Implements(valuerType) {
+		return reflect.Value{}, false, nil
+	}
+	// nil pointers are handled as regular pointers
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.Value{}, false, nil
+	}
+	val, err := v.Interface().(driver.Valuer).Value()
+	if err != nil || val == nil {
+		return reflect.Value{}, true, err
+	}
+	return reflect.ValueOf(val), true, nil
+}
+
 type zeroable interface {
 	IsZero() bool
 }
 
+// Emptier is an interface implemented by any type that wishes to decide
+// itself whether it is empty for the purposes of the "omitempty" option.
+type Emptier interface {
+	IsEmpty() bool
+}
+
 // isEmptyValue checks if a value should be considered empty for the purposes
 // of omitting fields with the "omitempty" option.
 func isEmptyValue(v reflect.Value) bool {
+	if v.IsValid() && v.CanInterface() && !((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		if e, ok := v.Interface().(Emptier); ok {
+			return e.IsEmpty()
+		}
+	}
+
 	switch v.Kind() {
 	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
 		return v.Len() == 0
@@ -369,8 +724,10 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
-func handleSliceValue(values url.Values, sv reflect.Value, scope string, count int, opts *tagOptions) (bool, error) {
-	if isEmptyValue(sv) {
+func handleSliceValue(values valueAdder, sv reflect.Value, scope string, count int, opts *tagOptions) (bool, error) {
+	// empty values are skipped, but for false with "yesno" or "onoff",
+	// which spell it out
+	if isEmptyValue(sv) && !(sv.Kind() == reflect.Bool && (opts.contains("yesno") || opts.contains("onoff"))) {
 		return true, nil
 	}
 	// recursively dereference pointers. break on nil pointers
@@ -408,15 +765,23 @@ func handleSliceValue(values url.Values, sv reflect.Value, scope string, count i
 	return true, nil
 }
 
-func reflectSlice(values url.Values, val reflect.Value, scope string, count int, opts *tagOptions) error {
+// reflectSlice encodes a slice of a map value or of a slice under scope, each
+// element with the key repeated, or indexed with the "idx" option, like a
+// slice field: "key[name]=a&key[name]=b" for a map[string][]struct. Empty
+// elements are skipped as in a slice field.
+// A top-level slice is read as pairs of keys and values, ["a", "1", "b", "2"]
+// encodes to "a=1&b=2", a key without value is dropped.
+func reflectSlice(values valueAdder, val reflect.Value, scope string, count int, opts *tagOptions) error {
 	l := val.Len()
-	if l == 0 {
-		return nil
-	}
 	for i := 0; i < l; i++ {
 		sv := val.Index(i)
 
-		already, err := handleSliceValue(values, sv, scope, count, opts)
+		key := scope
+		if scope != "" && opts.contains("idx") {
+			key = fmt.Sprintf("%s[%d]", scope, i)
+		}
+
+		already, err := handleSliceValue(values, sv, key, count, opts)
 		if err != nil {
 			return err
 		}
@@ -425,48 +790,66 @@ func reflectSlice(values url.Values, val reflect.Value, scope string, count int,
 			continue
 		}
 
-		endIndex := i + 1
-		if endIndex > l {
+		if scope != "" {
+			values.Add(key, valueString(sv, opts))
 			continue
 		}
-		if scope != "" {
-			values.Add(scope, valueString(sv, nil))
-			values.Add(scope, valueString(val.Index(endIndex), nil))
-		} else {
-			if endIndex > l-1 {
-				continue
-			}
-			key := valueString(sv, nil)
-			values.Add(key, valueString(val.Index(endIndex), nil))
+		if i+1 >= l {
+			break
 		}
+		values.Add(valueString(sv, nil), valueString(val.Index(i+1), nil))
 		i++
 	}
 	return nil
 }
 
-func reflectMap(values url.Values, val reflect.Value, scope string, count int, opts *tagOptions) error {
-	iter := val.MapRange()
-	for iter.Next() {
-		sv := iter.Value()
+func reflectMap(values valueAdder, val reflect.Value, scope string, count int, opts *tagOptions) error {
+	keys := val.MapKeys()
+	if _, ok := values.(*OrderedValues); ok {
+		// map iteration order is random, sort the keys to keep the output stable
+		sort.Slice(keys, func(i, j int) bool {
+			return valueString(keys[i], nil) < valueString(keys[j], nil)
+		})
+	}
+	for _, k := range keys {
+		sv := val.MapIndex(k)
 		if isEmptyValue(sv) {
 			continue
 		}
 
-		key := valueString(iter.Key(), nil)
+		key := valueString(k, nil)
 		if scope != "" {
+			if err := checkKey(key); err != nil {
+				return err
+			}
 			key = defaultScopeJoiner(scope, key)
 		}
 
-		// recursively dereference pointers. break on nil pointers
 		if sv.Kind() == reflect.Interface {
 			sv = sv.Elem()
 		}
+
+		if dv, ok, err := driverValue(sv); ok {
+			if err != nil {
+				return err
+			}
+			if dv.IsValid() {
+				values.Add(key, valueString(dv, opts))
+			}
+			continue
+		}
+
+		// recursively dereference pointers. break on nil pointers
 		for sv.Kind() == reflect.Ptr {
 			if sv.IsNil() {
 				break
 			}
 			sv = sv.Elem()
 		}
+		if sv.Kind() == reflect.Ptr {
+			// a nil pointer in an interface is skipped as a nil value is
+			continue
+		}
 
 		if sv.Type() == timeType {
 			values.Add(key, valueString(sv, opts))
@@ -494,6 +877,46 @@ func reflectMap(values url.Values, val reflect.Value, scope string, count int, o
 	return nil
 }
 
+// addURLValues adds the pairs of a url.Values field under scope, each value
+// of a key as a repeated parameter, e.g. "filter[a]=1&filter[a]=2".
+func addURLValues(values valueAdder, uv url.Values, scope string) error {
+	keys := make([]string, 0, len(uv))
+	for k := range uv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := k
+		if scope != "" {
+			if err := checkKey(k); err != nil {
+				return err
+			}
+			key = defaultScopeJoiner(scope, k)
+		}
+		for _, v := range uv[k] {
+			values.Add(key, v)
+		}
+	}
+	return nil
+}
+
+// checkKey returns an error for a scoped map key containing "[" or "]",
+// which would be read as scoping.
+func checkKey(key string) error {
+	if strings.ContainsAny(key, "[]") {
+		return fmt.Errorf("query: Values() map key %q contains \"[\" or \"]\"", key)
+	}
+	return nil
+}
+
+// epochUnits are the units of the "epoch" tag.
+var epochUnits = map[string]func(time.Time) int64{
+	"s":  time.Time.Unix,
+	"ms": time.Time.UnixMilli,
+	"us": time.Time.UnixMicro,
+	"ns": time.Time.UnixNano,
+}
+
 // valueString returns the string representation of a value
 func valueString(v reflect.Value, opts *tagOptions) string {
 	if v.Kind() == reflect.Interface {
@@ -514,6 +937,12 @@ func valueString(v reflect.Value, opts *tagOptions) string {
 		}
 
 		if opts != nil {
+			// query:"create_time" epoch:"us"
+			if unit := opts.epoch; unit != "" {
+				if f, ok := epochUnits[unit]; ok {
+					return strconv.FormatInt(f(t), 10)
+				}
+			}
 			// query:"create_time,unix"
 			if opts.contains("unix") {
 				return strconv.FormatInt(t.Unix(), 10)
@@ -522,39 +951,134 @@ func valueString(v reflect.Value, opts *tagOptions) string {
 			if opts.contains("unixmilli") {
 				return strconv.FormatInt(t.UnixNano()/1e6, 10)
 			}
+			// query:"create_time,unixmicro"
+			if opts.contains("unixmicro") {
+				return strconv.FormatInt(t.UnixMicro(), 10)
+			}
 			// query:"create_time,unixnano"
 			if opts.contains("unixnano") {
 				return strconv.FormatInt(t.UnixNano(), 10)
 			}
 			// query:"create_time:" layout:"2006-01-02 15:04:05"
-			if layout := opts.sf.Tag.Get("layout"); layout != "" {
+			if layout := opts.layout; layout != "" {
 				return t.Format(layout)
 			}
 		}
 		return t.Format(time.RFC3339)
 	}
 
-	// query:"name,int"
-	if opts != nil && v.Kind() == reflect.Bool && opts.contains("int") {
-		if v.Bool() {
-			return "1"
+	if opts != nil && v.Kind() == reflect.Bool {
+		var t, f string
+		switch {
+		// query:"name,int"
+		case opts.contains("int"):
+			t, f = "1", "0"
+		// query:"name,yesno"
+		case opts.contains("yesno"):
+			t, f = "yes", "no"
+		// query:"name,onoff"
+		case opts.contains("onoff"):
+			t, f = "on", "off"
+		}
+		if t != "" {
+			if v.Bool() {
+				return t
+			}
+			return f
+		}
+	}
+
+	// query:"name,lower" or query:"name,upper"
+	if opts != nil && v.Kind() == reflect.String {
+		if opts.contains("lower") {
+			return strings.ToLower(fmt.Sprint(v.Interface()))
+		}
+		if opts.contains("upper") {
+			return strings.ToUpper(fmt.Sprint(v.Interface()))
 		}
-		return "0"
 	}
 
 	// bytes to string
 	if b, ok := v.Interface().([]byte); ok {
+		if opts != nil {
+			// query:"name,base64"
+			if opts.contains("base64") {
+				return base64.RawURLEncoding.EncodeToString(b)
+			}
+			// query:"name,base64std"
+			if opts.contains("base64std") {
+				return base64.StdEncoding.EncodeToString(b)
+			}
+		}
 		return string(b)
 	}
 
 	return fmt.Sprint(v.Interface())
 }
 
+// tagValue returns the "query" tag of sf, or the "url" tag if not set.
+func tagValue(sf reflect.StructField) string {
+	for _, tn := range tags {
+		if tag := sf.Tag.Get(tn); tag != "" {
+			return tag
+		}
+	}
+	return ""
+}
+
 // tagOptions is the string following a comma in a struct field's "query" "url" tag, or
 // the empty string. It does not include the leading comma.
 type tagOptions struct {
 	kvs map[string]string
-	sf  reflect.StructField
+	// the "layout", "del" and "epoch" tags of the field
+	layout string
+	del    string
+	epoch  string
+}
+
+// field is the metadata of an encoded struct field, parsed once per type.
+type field struct {
+	index int
+	sf    reflect.StructField
+	// name is the name of the tag, "" if not set
+	name string
+	opts *tagOptions
+}
+
+// structFields is the metadata of an encoded struct type, parsed once.
+type structFields struct {
+	list []field
+	// flat is set if the struct can be encoded by encodeFlat
+	flat []flatField
+}
+
+// fieldCache maps a struct type to its *structFields.
+var fieldCache sync.Map
+
+// cachedFields returns the exported fields of the struct type typ, without
+// the fields tagged "-". The fields and their options are shared, read-only.
+func cachedFields(typ reflect.Type) *structFields {
+	if fields, ok := fieldCache.Load(typ); ok {
+		return fields.(*structFields)
+	}
+
+	fields := &structFields{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		tag := tagValue(sf)
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag, sf)
+		fields.list = append(fields.list, field{index: i, sf: sf, name: name, opts: opts})
+	}
+	fields.flat = flatFields(fields.list)
+
+	actual, _ := fieldCache.LoadOrStore(typ, fields)
+	return actual.(*structFields)
 }
 
 // parseTag splits a struct field's url tag into its name and comma-separated
@@ -563,8 +1087,10 @@ func parseTag(tag string, sf reflect.StructField) (string, *tagOptions) {
 	s := strings.Split(tag, ",")
 	opts := s[1:]
 	tagOpts := &tagOptions{
-		kvs: make(map[string]string),
-		sf:  sf,
+		kvs:    make(map[string]string),
+		layout: sf.Tag.Get("layout"),
+		del:    sf.Tag.Get("del"),
+		epoch:  sf.Tag.Get("epoch"),
 	}
 	if len(opts) > 0 {
 		for _, v := range opts {
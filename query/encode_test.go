@@ -1,10 +1,13 @@
 package query
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -124,7 +127,7 @@ func TestValues_map(t *testing.T) {
 		// slices
 		{input: map[string][]int{"a": []int{1, 2}}, want: url.Values{"a": {"1", "2"}}},
 		{input: map[string][]string{"a": []string{"1", "2"}}, want: url.Values{"a": {"1", "2"}}},
-		{input: map[string][]bool{"a": []bool{true, false}}, want: url.Values{"a": {"true", "false"}}},
+		{input: map[string][]bool{"a": []bool{true, false}}, want: url.Values{"a": {"true"}}},
 		{input: map[string][]map[string]string{
 			"first": []map[string]string{
 				{
@@ -272,6 +275,43 @@ func TestValues_BasicTypes(t *testing.T) {
 			}{time.Date(2000, 1, 1, 12, 34, 56, 0, time.UTC)},
 			url.Values{"V": {"946730096000000000"}},
 		},
+		{
+			struct {
+				Milli time.Time `query:"milli,unixmilli"`
+				Micro time.Time `query:"micro,unixmicro"`
+				Nano  time.Time `query:"nano,unixnano"`
+			}{
+				time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+				time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+				time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+			},
+			url.Values{"milli": {"946730096123"}, "micro": {"946730096123456"}, "nano": {"946730096123456789"}},
+		},
+		{
+			struct {
+				S       time.Time   `query:"s" epoch:"s"`
+				Ms      time.Time   `query:"ms" epoch:"ms"`
+				Us      *time.Time  `query:"us" epoch:"us"`
+				Ns      []time.Time `query:"ns" epoch:"ns"`
+				Over    time.Time   `query:"over,unix" epoch:"ms"`
+				Unknown time.Time   `query:"unknown" epoch:"h"`
+			}{
+				S:       time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+				Ms:      time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+				Us:      &[]time.Time{time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC)}[0],
+				Ns:      []time.Time{time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC)},
+				Over:    time.Date(2000, 1, 1, 12, 34, 56, 123456789, time.UTC),
+				Unknown: time.Date(2000, 1, 1, 12, 34, 56, 0, time.UTC),
+			},
+			url.Values{
+				"s":       {"946730096"},
+				"ms":      {"946730096123"},
+				"us":      {"946730096123456"},
+				"ns":      {"946730096123456789"},
+				"over":    {"946730096123"},
+				"unknown": {"2000-01-01T12:34:56Z"},
+			},
+		},
 		{
 			struct {
 				Date    time.Time `query:"date" layout:"2006-01-02"`
@@ -354,6 +394,53 @@ func TestValues_time(t *testing.T) {
 	}
 }
 
+func TestValues_timePointersInMap(t *testing.T) {
+	start := time.Date(2000, 1, 1, 12, 34, 56, 0, time.UTC)
+	var zeroTime time.Time
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			struct {
+				Times map[string]*time.Time `query:"times" layout:"2006-01-02"`
+			}{
+				Times: map[string]*time.Time{"start": &start, "end": nil},
+			},
+			url.Values{"times[start]": {"2000-01-01"}},
+		},
+		{
+			struct {
+				Times map[string]*time.Time `query:"times,unix"`
+			}{
+				Times: map[string]*time.Time{"start": &start},
+			},
+			url.Values{"times[start]": {"946730096"}},
+		},
+		{
+			struct {
+				Times map[string]**time.Time `query:"times" layout:"2006-01-02"`
+			}{
+				Times: map[string]**time.Time{"start": func() **time.Time { p := &start; return &p }()},
+			},
+			url.Values{"times[start]": {"2000-01-01"}},
+		},
+		{
+			struct {
+				Times map[string]interface{} `query:"times" layout:"2006-01-02"`
+			}{
+				Times: map[string]interface{}{"start": &start, "zero": &zeroTime},
+			},
+			url.Values{"times[start]": {"2000-01-01"}, "times[zero]": {""}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
 func TestValues_Pointers(t *testing.T) {
 	str := "s"
 	strPtr := &str
@@ -695,6 +782,52 @@ func TestValues_inline(t *testing.T) {
 	}
 }
 
+func TestValues_idx(t *testing.T) {
+	type Item struct {
+		Name string   `query:"name"`
+		Tags []string `query:"tags,idx"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// scalars
+		{
+			struct {
+				V []int `query:"v,idx"`
+			}{[]int{1, 2, 3}},
+			url.Values{"v[0]": {"1"}, "v[1]": {"2"}, "v[2]": {"3"}},
+		},
+		// structs, including nested indexed scalars
+		{
+			struct {
+				V []Item `query:"v,idx"`
+			}{[]Item{
+				{Name: "a", Tags: []string{"x", "y"}},
+				{Name: "b"},
+			}},
+			url.Values{
+				"v[0][name]":    {"a"},
+				"v[0][tags][0]": {"x"},
+				"v[0][tags][1]": {"y"},
+				"v[1][name]":    {"b"},
+			},
+		},
+		// pointers to structs
+		{
+			struct {
+				V []*Item `query:"v,idx"`
+			}{[]*Item{{Name: "a"}, {Name: "b"}}},
+			url.Values{"v[0][name]": {"a"}, "v[1][name]": {"b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
 func TestValues_NestedTypes(t *testing.T) {
 	type SubNested struct {
 		Value string `query:"value"`
@@ -1112,6 +1245,165 @@ func TestValues_CustomEncodingPointer(t *testing.T) {
 	}
 }
 
+func TestValues_DriverValuer(t *testing.T) {
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// invalid values are omitted
+		{
+			struct {
+				Name sql.NullString `query:"name"`
+				Age  sql.NullInt64  `query:"age"`
+			}{},
+			url.Values{},
+		},
+		{
+			struct {
+				Name sql.NullString `query:"name"`
+				Age  sql.NullInt64  `query:"age"`
+			}{
+				Name: sql.NullString{String: "acme", Valid: true},
+				Age:  sql.NullInt64{Int64: 0, Valid: true},
+			},
+			url.Values{"name": {"acme"}, "age": {"0"}},
+		},
+		{
+			struct {
+				Name *sql.NullString `query:"name"`
+				Age  *sql.NullInt64  `query:"age,omitempty"`
+			}{
+				Name: &sql.NullString{String: "acme", Valid: true},
+			},
+			url.Values{"name": {"acme"}},
+		},
+		{
+			map[string]interface{}{
+				"name": sql.NullString{String: "acme", Valid: true},
+				"age":  sql.NullInt64{Int64: 18, Valid: false},
+			},
+			url.Values{"name": {"acme"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+type emptyWhenDefault struct {
+	Value string
+}
+
+func (e emptyWhenDefault) IsEmpty() bool {
+	return e.Value == "" || e.Value == "default"
+}
+
+func TestValues_Emptier(t *testing.T) {
+	type S struct {
+		A emptyWhenDefault  `query:"a,omitempty"`
+		B *emptyWhenDefault `query:"b,omitempty"`
+		C emptyWhenDefault  `query:"c"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			S{
+				A: emptyWhenDefault{Value: "default"},
+				B: &emptyWhenDefault{Value: "default"},
+				C: emptyWhenDefault{Value: "default"},
+			},
+			url.Values{"c[Value]": {"default"}},
+		},
+		{
+			S{
+				A: emptyWhenDefault{Value: "a"},
+				B: &emptyWhenDefault{Value: "b"},
+			},
+			url.Values{"a[Value]": {"a"}, "b[Value]": {"b"}, "c[Value]": {""}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValuesStrict(t *testing.T) {
+	type S struct {
+		Name string `query:"name"`
+	}
+
+	tests := []struct {
+		input   interface{}
+		want    url.Values
+		wantErr bool
+	}{
+		{input: nil, wantErr: true},
+		{input: (*S)(nil), wantErr: true},
+		{input: (**S)(nil), wantErr: true},
+		{input: 1, wantErr: true},
+		{input: S{Name: "acme"}, want: url.Values{"name": {"acme"}}},
+		{input: &S{Name: "acme"}, want: url.Values{"name": {"acme"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ValuesStrict(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValuesStrict(%#v) error = %v, wantErr %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ValuesStrict(%#v) mismatch:\n%s", tt.input, diff)
+			}
+		}
+
+		// Values stays lenient
+		if tt.input == nil || reflect.ValueOf(tt.input).Kind() == reflect.Ptr {
+			if _, err = Values(tt.input); err != nil {
+				t.Errorf("Values(%#v) returned error: %v", tt.input, err)
+			}
+		}
+	}
+}
+
+func TestEncodePercent(t *testing.T) {
+	tests := []struct {
+		input       url.Values
+		wantEncode  string
+		wantPercent string
+	}{
+		{
+			input:       url.Values{},
+			wantEncode:  "",
+			wantPercent: "",
+		},
+		{
+			input:       url.Values{"q": {"hello world"}},
+			wantEncode:  "q=hello+world",
+			wantPercent: "q=hello%20world",
+		},
+		{
+			input:       url.Values{"q": {"a+b c"}, "my key": {"x", "y z"}},
+			wantEncode:  "my+key=x&my+key=y+z&q=a%2Bb+c",
+			wantPercent: "my%20key=x&my%20key=y%20z&q=a%2Bb%20c",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.input.Encode(); got != tt.wantEncode {
+			t.Errorf("Encode(%v) = %q, want %q", tt.input, got, tt.wantEncode)
+		}
+		if got := EncodePercent(tt.input); got != tt.wantPercent {
+			t.Errorf("EncodePercent(%v) = %q, want %q", tt.input, got, tt.wantPercent)
+		}
+	}
+}
+
 func TestIsEmptyValue(t *testing.T) {
 	str := "string"
 	tests := []struct {
@@ -1196,3 +1488,980 @@ func TestParseTag(t *testing.T) {
 		}
 	}
 }
+
+type interfaceInner struct {
+	A int    `query:"a"`
+	B string `query:"b,omitempty"`
+}
+
+type interfaceEncoder struct{}
+
+func (interfaceEncoder) EncodeValues(key string, v *url.Values) error {
+	v.Set(key, "custom")
+	return nil
+}
+
+func TestValues_InterfaceFields(t *testing.T) {
+	var nilInner *interfaceInner
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			struct {
+				F any `query:"f"`
+			}{F: interfaceInner{A: 1}},
+			url.Values{"f[a]": {"1"}},
+		},
+		{
+			struct {
+				F any `query:"f"`
+			}{F: &interfaceInner{A: 2, B: "x"}},
+			url.Values{"f[a]": {"2"}, "f[b]": {"x"}},
+		},
+		{
+			struct {
+				F any `query:"f"`
+			}{F: map[string]any{"k": &interfaceInner{A: 3}}},
+			url.Values{"f[k][a]": {"3"}},
+		},
+		{
+			struct {
+				F any `query:"f"`
+			}{F: interfaceEncoder{}},
+			url.Values{"f": {"custom"}},
+		},
+		// nil interface and nil pointer
+		{
+			struct {
+				F any `query:"f"`
+			}{},
+			url.Values{"f": {""}},
+		},
+		{
+			struct {
+				F any `query:"f,omitempty"`
+			}{},
+			url.Values{},
+		},
+		{
+			struct {
+				F any `query:"f"`
+			}{F: nilInner},
+			url.Values{"f": {""}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_ExpandNil(t *testing.T) {
+	type SubNested struct {
+		Value string `query:"value"`
+		Count int    `query:"count,omitempty"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// default: a single empty value
+		{
+			struct {
+				B *SubNested `query:"b"`
+			}{},
+			url.Values{"b": {""}},
+		},
+		{
+			struct {
+				B *SubNested `query:"b,expandnil"`
+			}{},
+			url.Values{"b[value]": {""}},
+		},
+		{
+			struct {
+				B **SubNested `query:"b,expandnil"`
+			}{},
+			url.Values{"b[value]": {""}},
+		},
+		{
+			struct {
+				B *SubNested `query:"b,expandnil"`
+			}{B: &SubNested{Value: "v"}},
+			url.Values{"b[value]": {"v"}},
+		},
+		// only pointers to struct are expanded
+		{
+			struct {
+				S *string    `query:"s,expandnil"`
+				T *time.Time `query:"t,expandnil"`
+			}{},
+			url.Values{"s": {""}, "t": {""}},
+		},
+		// omitempty takes precedence
+		{
+			struct {
+				B *SubNested `query:"b,omitempty,expandnil"`
+			}{},
+			url.Values{},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_URLValuesField(t *testing.T) {
+	type Nested struct {
+		Filter url.Values `query:"filter"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// single value
+		{
+			struct {
+				Filter url.Values `query:"filter"`
+			}{Filter: url.Values{"status": {"open"}}},
+			url.Values{"filter[status]": {"open"}},
+		},
+		// multiple values are repeated
+		{
+			struct {
+				Filter url.Values `query:"filter"`
+			}{Filter: url.Values{"status": {"open"}, "label": {"a", "b", "c"}}},
+			url.Values{"filter[status]": {"open"}, "filter[label]": {"a", "b", "c"}},
+		},
+		// inline
+		{
+			struct {
+				Filter url.Values `query:",inline"`
+				Page   int        `query:"page"`
+			}{Filter: url.Values{"status": {"open"}, "label": {"a", "b"}}, Page: 2},
+			url.Values{"status": {"open"}, "label": {"a", "b"}, "page": {"2"}},
+		},
+		// pointer and nested scope
+		{
+			struct {
+				Filter *url.Values `query:"filter"`
+				Nested Nested      `query:"nested"`
+			}{
+				Filter: &url.Values{"author.name": {"1"}},
+				Nested: Nested{Filter: url.Values{"status": {"open"}}},
+			},
+			url.Values{"filter[author.name]": {"1"}, "nested[filter][status]": {"open"}},
+		},
+		// empty
+		{
+			struct {
+				Filter url.Values `query:"filter,omitempty"`
+				Other  url.Values `query:"other"`
+			}{},
+			url.Values{},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+
+	// brackets in a scoped key would be read as scoping
+	_, err := Values(struct {
+		Filter url.Values `query:"filter"`
+	}{Filter: url.Values{"a]b": {"1"}}})
+	if err == nil || !strings.Contains(err.Error(), "map key") {
+		t.Errorf("Values() error = %v, want a map key error", err)
+	}
+}
+
+func TestValues_Base64(t *testing.T) {
+	data := []byte{0xfb, 0xff}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// url alphabet, without padding
+		{
+			struct {
+				B []byte `query:"b,base64"`
+			}{B: data},
+			url.Values{"b": {"-_8"}},
+		},
+		// standard alphabet, with padding
+		{
+			struct {
+				B []byte `query:"b,base64std"`
+			}{B: data},
+			url.Values{"b": {"+/8="}},
+		},
+		{
+			struct {
+				B *[]byte `query:"b,base64"`
+			}{B: &data},
+			url.Values{"b": {"-_8"}},
+		},
+		{
+			struct {
+				B []byte `query:"b,base64,omitempty"`
+				C []byte `query:"c,base64"`
+			}{C: []byte{}},
+			url.Values{"c": {""}},
+		},
+		// default: a slice of numbers
+		{
+			struct {
+				B []byte `query:"b"`
+			}{B: data},
+			url.Values{"b": {"251", "255"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_MapOfStructSlices(t *testing.T) {
+	type User struct {
+		Name string `query:"name"`
+		Age  int    `query:"age,omitempty"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// top level, like a []struct field
+		{
+			map[string][]User{"users": {{Name: "a", Age: 1}, {Name: "b"}}},
+			url.Values{"users[name]": {"a", "b"}, "users[age]": {"1"}},
+		},
+		// nil pointers are skipped
+		{
+			map[string][]*User{"users": {{Name: "a"}, nil, {Name: "b"}}},
+			url.Values{"users[name]": {"a", "b"}},
+		},
+		// scalars repeat the key, also for an odd length
+		{
+			map[string][]string{"k": {"a", "b", "c"}},
+			url.Values{"k": {"a", "b", "c"}},
+		},
+		// empty elements are skipped like in a slice field, but with yesno
+		{
+			struct {
+				A []string            `query:"a"`
+				M map[string][]string `query:"m"`
+				B []bool              `query:"b"`
+				N map[string][]bool   `query:"n"`
+				Y map[string][]bool   `query:"y,yesno"`
+			}{
+				A: []string{"", "x"},
+				M: map[string][]string{"a": {"", "x"}},
+				B: []bool{false, true},
+				N: map[string][]bool{"b": {false, true}},
+				Y: map[string][]bool{"b": {false, true}},
+			},
+			url.Values{
+				"a":    {"x"},
+				"m[a]": {"x"},
+				"b":    {"true"},
+				"n[b]": {"true"},
+				"y[b]": {"no", "yes"},
+			},
+		},
+		// as a field, with idx
+		{
+			struct {
+				M map[string][]User `query:"m"`
+				I map[string][]User `query:"i,idx"`
+			}{
+				M: map[string][]User{"users": {{Name: "a"}, {Name: "b"}}},
+				I: map[string][]User{"users": {{Name: "a"}, {Name: "b"}}},
+			},
+			url.Values{
+				"m[users][name]":    {"a", "b"},
+				"i[users][0][name]": {"a"},
+				"i[users][1][name]": {"b"},
+			},
+		},
+		// top-level slices are still pairs of keys and values
+		{
+			[]string{"a", "1", "b"},
+			url.Values{"a": {"1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_MapOfPointers(t *testing.T) {
+	s := []string{"a", "b"}
+	m := map[string]string{"x": "1", "y": "2"}
+	var (
+		nilSlice []string
+		nilMap   map[string]string
+	)
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// pointers to slices are expanded, nil pointers and nil slices skipped
+		{
+			map[string]*[]string{"s": &s, "nil": nil, "empty": &nilSlice},
+			url.Values{"s": {"a", "b"}},
+		},
+		// pointers to maps are scoped, nil pointers and nil maps skipped
+		{
+			map[string]*map[string]string{"m": &m, "nil": nil, "empty": &nilMap},
+			url.Values{"m[x]": {"1"}, "m[y]": {"2"}},
+		},
+		// typed nil pointers in an interface are skipped too
+		{
+			map[string]interface{}{
+				"s":      &s,
+				"m":      &m,
+				"nilS":   (*[]string)(nil),
+				"nilM":   (*map[string]string)(nil),
+				"nilPtr": (**[]string)(nil),
+			},
+			url.Values{"s": {"a", "b"}, "m[x]": {"1"}, "m[y]": {"2"}},
+		},
+		// as fields, with idx
+		{
+			struct {
+				S map[string]*[]string          `query:"s"`
+				I map[string]*[]string          `query:"i,idx"`
+				M map[string]*map[string]string `query:"m"`
+			}{
+				S: map[string]*[]string{"k": &s, "nil": nil},
+				I: map[string]*[]string{"k": &s},
+				M: map[string]*map[string]string{"k": &m, "nil": nil},
+			},
+			url.Values{
+				"s[k]":    {"a", "b"},
+				"i[k][0]": {"a"},
+				"i[k][1]": {"b"},
+				"m[k][x]": {"1"},
+				"m[k][y]": {"2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_LowerUpper(t *testing.T) {
+	type State string
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			struct {
+				S State  `query:"s,lower"`
+				U string `query:"u,upper"`
+			}{S: "Open", U: "asc"},
+			url.Values{"s": {"open"}, "u": {"ASC"}},
+		},
+		// slices
+		{
+			struct {
+				L []State  `query:"l,lower"`
+				U []string `query:"u,upper,comma"`
+			}{L: []State{"Open", "CLOSED"}, U: []string{"a", "b"}},
+			url.Values{"l": {"open", "closed"}, "u": {"A,B"}},
+		},
+		// composes with omitempty
+		{
+			struct {
+				S string   `query:"s,lower,omitempty"`
+				L []string `query:"l,upper,omitempty"`
+				P *string  `query:"p,upper,omitempty"`
+			}{},
+			url.Values{},
+		},
+		// only strings are case-folded
+		{
+			struct {
+				B bool `query:"b,upper"`
+			}{B: true},
+			url.Values{"b": {"true"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_BoolOptions(t *testing.T) {
+	type Bools struct {
+		Default bool `query:"default"`
+		Int     bool `query:"int,int"`
+		YesNo   bool `query:"yesno,yesno"`
+		OnOff   bool `query:"onoff,onoff"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			Bools{Default: true, Int: true, YesNo: true, OnOff: true},
+			url.Values{"default": {"true"}, "int": {"1"}, "yesno": {"yes"}, "onoff": {"on"}},
+		},
+		{
+			Bools{},
+			url.Values{"default": {"false"}, "int": {"0"}, "yesno": {"no"}, "onoff": {"off"}},
+		},
+		// slices of bools
+		{
+			struct {
+				Default []bool `query:"default"`
+				Int     []bool `query:"int,int"`
+				YesNo   []bool `query:"yesno,yesno,comma"`
+				OnOff   []bool `query:"onoff,onoff,brackets"`
+			}{
+				Default: []bool{true, false},
+				Int:     []bool{true, false},
+				YesNo:   []bool{true, false},
+				OnOff:   []bool{false, true},
+			},
+			// false elements are skipped but with yesno and onoff
+			url.Values{
+				"default": {"true"},
+				"int":     {"1"},
+				"yesno":   {"yes,no"},
+				"onoff[]": {"off", "on"},
+			},
+		},
+		// pointers and omitempty
+		{
+			struct {
+				P *bool `query:"p,yesno"`
+				O bool  `query:"o,onoff,omitempty"`
+			}{P: new(bool)},
+			url.Values{"p": {"no"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+type semver struct {
+	Major int `query:"major"`
+	Minor int `query:"minor"`
+}
+
+func (v semver) String() string { return fmt.Sprintf("%d.%d", v.Major, v.Minor) }
+
+type ptrStringer struct {
+	Name string `query:"name"`
+}
+
+func (p *ptrStringer) String() string { return "ptr:" + p.Name }
+
+func TestValues_StringOption(t *testing.T) {
+	v := semver{Major: 1, Minor: 2}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// default: recursion into the struct
+		{
+			struct {
+				V semver `query:"v"`
+			}{V: v},
+			url.Values{"v[major]": {"1"}, "v[minor]": {"2"}},
+		},
+		{
+			struct {
+				V semver  `query:"v,string"`
+				P *semver `query:"p,string"`
+				N *semver `query:"n,string"`
+			}{V: v, P: &v},
+			url.Values{"v": {"1.2"}, "p": {"1.2"}, "n": {""}},
+		},
+		// pointer receiver
+		{
+			struct {
+				S ptrStringer `query:"s,string"`
+			}{S: ptrStringer{Name: "acme"}},
+			url.Values{"s": {"ptr:acme"}},
+		},
+		// not a Stringer: the option is ignored
+		{
+			struct {
+				N struct {
+					A int `query:"a"`
+				} `query:"n,string"`
+			}{},
+			url.Values{"n[a]": {"0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+// A non-nil pointer to a zero value is the way to send an explicit zero with
+// omitempty, a nil pointer is omitted.
+func TestValues_OmitemptyPointerZero(t *testing.T) {
+	type Numbers struct {
+		Int     *int     `query:"int,omitempty"`
+		Int8    *int8    `query:"int8,omitempty"`
+		Int16   *int16   `query:"int16,omitempty"`
+		Int32   *int32   `query:"int32,omitempty"`
+		Int64   *int64   `query:"int64,omitempty"`
+		Uint    *uint    `query:"uint,omitempty"`
+		Uint8   *uint8   `query:"uint8,omitempty"`
+		Uint16  *uint16  `query:"uint16,omitempty"`
+		Uint32  *uint32  `query:"uint32,omitempty"`
+		Uint64  *uint64  `query:"uint64,omitempty"`
+		Float32 *float32 `query:"float32,omitempty"`
+		Float64 *float64 `query:"float64,omitempty"`
+		Bool    *bool    `query:"bool,omitempty"`
+		BoolInt *bool    `query:"boolint,int,omitempty"`
+	}
+
+	var (
+		i   int
+		i8  int8
+		i16 int16
+		i32 int32
+		i64 int64
+		u   uint
+		u8  uint8
+		u16 uint16
+		u32 uint32
+		u64 uint64
+		f32 float32
+		f64 float64
+		b   bool
+	)
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{Numbers{}, url.Values{}},
+		{
+			Numbers{
+				Int: &i, Int8: &i8, Int16: &i16, Int32: &i32, Int64: &i64,
+				Uint: &u, Uint8: &u8, Uint16: &u16, Uint32: &u32, Uint64: &u64,
+				Float32: &f32, Float64: &f64, Bool: &b, BoolInt: &b,
+			},
+			url.Values{
+				"int": {"0"}, "int8": {"0"}, "int16": {"0"}, "int32": {"0"}, "int64": {"0"},
+				"uint": {"0"}, "uint8": {"0"}, "uint16": {"0"}, "uint32": {"0"}, "uint64": {"0"},
+				"float32": {"0"}, "float64": {"0"}, "bool": {"false"}, "boolint": {"0"},
+			},
+		},
+		// non-pointer zero values are omitted
+		{
+			struct {
+				I int     `query:"i,omitempty"`
+				F float64 `query:"f,omitempty"`
+				B bool    `query:"b,omitempty"`
+			}{},
+			url.Values{},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+type signedParams struct {
+	User  string `query:"user"`
+	Limit int    `query:"limit"`
+}
+
+// QueryValues adds a toy signature over the fields.
+func (p signedParams) QueryValues() (url.Values, error) {
+	return url.Values{"sig": {fmt.Sprintf("%s:%d", p.User, p.Limit)}}, nil
+}
+
+type ptrSignedParams struct {
+	User string `query:"user"`
+}
+
+func (p *ptrSignedParams) QueryValues() (url.Values, error) {
+	if p.User == "" {
+		return nil, errors.New("no user")
+	}
+	return url.Values{"sig": {"ptr:" + p.User}}, nil
+}
+
+func TestValues_QueryValuer(t *testing.T) {
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			signedParams{User: "acme", Limit: 10},
+			url.Values{"user": {"acme"}, "limit": {"10"}, "sig": {"acme:10"}},
+		},
+		{
+			&signedParams{User: "acme", Limit: 10},
+			url.Values{"user": {"acme"}, "limit": {"10"}, "sig": {"acme:10"}},
+		},
+		// pointer receiver
+		{
+			ptrSignedParams{User: "acme"},
+			url.Values{"user": {"acme"}, "sig": {"ptr:acme"}},
+		},
+		{
+			&ptrSignedParams{User: "acme"},
+			url.Values{"user": {"acme"}, "sig": {"ptr:acme"}},
+		},
+		// nested structs are not computed
+		{
+			struct {
+				P signedParams `query:"p"`
+			}{P: signedParams{User: "acme"}},
+			url.Values{"p[user]": {"acme"}, "p[limit]": {"0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+
+	if _, err := Values(&ptrSignedParams{}); err == nil || err.Error() != "no user" {
+		t.Errorf("Values() error = %v, want no user", err)
+	}
+
+	ordered, err := ValuesOrdered(signedParams{User: "acme", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ordered.Encode(), "user=acme&limit=10&sig=acme%3A10"; got != want {
+		t.Errorf("ValuesOrdered().Encode() = %q, want %q", got, want)
+	}
+}
+
+func TestValues_DeepInline(t *testing.T) {
+	type Leaf struct {
+		M map[string]string `query:",inline"`
+		V string            `query:"v,omitempty"`
+	}
+	type Mid struct {
+		Leaf Leaf  `query:",inline"`
+		Ptr  *Leaf `query:",inline"`
+		Sc   Leaf  `query:"sc,omitempty"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		// scoped > inline > inline map
+		{
+			struct {
+				Mid Mid `query:"mid"`
+			}{Mid{Leaf: Leaf{M: map[string]string{"a": "1"}, V: "x"}}},
+			url.Values{"mid[a]": {"1"}, "mid[v]": {"x"}},
+		},
+		// inline > inline > inline map, and scoped below inline
+		{
+			struct {
+				Mid Mid `query:",inline"`
+			}{Mid{
+				Leaf: Leaf{M: map[string]string{"a": "1"}},
+				Sc:   Leaf{M: map[string]string{"b": "2"}},
+			}},
+			url.Values{"a": {"1"}, "sc[b]": {"2"}},
+		},
+		// scoped > inline pointer > inline map
+		{
+			struct {
+				Mid Mid `query:"mid"`
+			}{Mid{Ptr: &Leaf{M: map[string]string{"a": "1"}}}},
+			url.Values{"mid[a]": {"1"}},
+		},
+		// slice element and map value > inline > inline map
+		{
+			struct {
+				Items []Mid          `query:"items,idx"`
+				MM    map[string]Mid `query:"mm"`
+			}{
+				Items: []Mid{{Leaf: Leaf{M: map[string]string{"a": "1"}}}},
+				MM:    map[string]Mid{"k": {Leaf: Leaf{M: map[string]string{"b": "2"}}}},
+			},
+			url.Values{"items[0][a]": {"1"}, "mm[k][b]": {"2"}},
+		},
+		// a nil inline pointer adds nothing, not its field name
+		{
+			struct {
+				Mid Mid  `query:"mid"`
+				Ptr *Mid `query:",inline"`
+			}{},
+			url.Values{},
+		},
+		// unless expanded
+		{
+			struct {
+				Ptr *struct {
+					V string `query:"v"`
+				} `query:",inline,expandnil"`
+			}{},
+			url.Values{"v": {""}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValues_Collapse(t *testing.T) {
+	type Item struct {
+		Name string `query:"name"`
+	}
+	type params struct {
+		Brackets []string `query:"b,brackets,collapse"`
+		Numbered []int    `query:"n,numbered,collapse"`
+		Idx      []string `query:"i,idx,collapse"`
+		Items    []Item   `query:"items,idx,collapse"`
+		Comma    []string `query:"c,comma,collapse"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  url.Values
+	}{
+		{
+			params{
+				Brackets: []string{"x"},
+				Numbered: []int{1},
+				Idx:      []string{"y"},
+				Items:    []Item{{Name: "a"}},
+				Comma:    []string{"z"},
+			},
+			url.Values{"b": {"x"}, "n": {"1"}, "i": {"y"}, "items[name]": {"a"}, "c": {"z"}},
+		},
+		{
+			params{
+				Brackets: []string{"x", "y"},
+				Numbered: []int{1, 2},
+				Idx:      []string{"y", "z"},
+				Items:    []Item{{Name: "a"}, {Name: "b"}},
+				Comma:    []string{"z", "w"},
+			},
+			url.Values{
+				"b[]":            {"x", "y"},
+				"n0":             {"1"},
+				"n1":             {"2"},
+				"i[0]":           {"y"},
+				"i[1]":           {"z"},
+				"items[0][name]": {"a"},
+				"items[1][name]": {"b"},
+				"c":              {"z,w"},
+			},
+		},
+		// without collapse a single element keeps the mode
+		{
+			struct {
+				B []string `query:"b,brackets"`
+			}{[]string{"x"}},
+			url.Values{"b[]": {"x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		testValue(t, tt.input, tt.want)
+	}
+}
+
+func TestValuesStrict_Tags(t *testing.T) {
+	type Inner struct {
+		Tags string `query:"tags" del:","`
+	}
+	type Node struct {
+		Next *Node     `query:"next"`
+		At   time.Time `query:"at" layout:"2006-01-02"`
+	}
+
+	tests := []struct {
+		input   interface{}
+		wantErr string
+	}{
+		// valid
+		{input: struct {
+			At    time.Time            `query:"at" layout:"2006-01-02"`
+			Ptr   *time.Time           `query:"ptr" layout:"2006-01-02"`
+			Times []time.Time          `query:"times" layout:"2006-01-02"`
+			ByKey map[string]time.Time `query:"by_key" layout:"2006-01-02"`
+			Tags  []string             `query:"tags" del:"|"`
+			Arr   [2]int               `query:"arr" del:"|"`
+			Skip  string               `query:"-" layout:"2006-01-02"`
+		}{}},
+		{input: &Node{Next: &Node{}}},
+		// misuse
+		{
+			input: struct {
+				Name string `query:"name" layout:"2006-01-02"`
+			}{},
+			wantErr: "layout tag on non-time field",
+		},
+		{
+			input: struct {
+				Count int `url:"count" del:","`
+			}{},
+			wantErr: "del tag on non-slice field",
+		},
+		{
+			input: struct {
+				At time.Time `query:"at" del:","`
+			}{},
+			wantErr: "del tag on non-slice field",
+		},
+		{
+			input: struct {
+				At int64 `query:"at" epoch:"ms"`
+			}{},
+			wantErr: "epoch tag on non-time field",
+		},
+		{
+			input: struct {
+				At time.Time `query:"at" epoch:"h"`
+			}{},
+			wantErr: `unknown epoch unit "h"`,
+		},
+		// nested
+		{
+			input: struct {
+				Inner []Inner `query:"inner"`
+			}{},
+			wantErr: "del tag on non-slice field query.Inner.Tags",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := ValuesStrict(tt.input)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValuesStrict(%#v) returned error: %v", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ValuesStrict(%#v) error = %v, want %q", tt.input, err, tt.wantErr)
+		}
+		// Values stays lenient
+		if _, err = Values(tt.input); err != nil {
+			t.Errorf("Values(%#v) returned error: %v", tt.input, err)
+		}
+	}
+}
+
+func TestValues_FieldCache(t *testing.T) {
+	type Inner struct {
+		V customEncodedInt `query:"v"`
+	}
+	type S struct {
+		Strings customEncodedStrings `query:"s"`
+		Int     *customEncodedInt    `query:"i,omitempty"`
+		Inner   Inner                `query:"inner"`
+		At      time.Time            `query:"at" layout:"2006-01-02"`
+		Tags    []string             `query:"tags" del:"|"`
+		Skip    string               `query:"-"`
+		private string
+	}
+
+	one := customEncodedInt(1)
+	at := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := url.Values{
+		"s.0":      {"a"},
+		"s.1":      {"b"},
+		"i":        {"_1"},
+		"inner[v]": {"_2"},
+		"at":       {"2000-01-01"},
+		"tags":     {"x|y"},
+	}
+
+	// the parsed fields are cached by the first call, later and concurrent
+	// calls encode the same
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				testValue(t, S{
+					Strings: customEncodedStrings{"a", "b"},
+					Int:     &one,
+					Inner:   Inner{V: 2},
+					At:      at,
+					Tags:    []string{"x", "y"},
+					Skip:    "skip",
+					private: "private",
+				}, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the options of a cached field are not shared with other types
+	testValue(t, struct {
+		At   time.Time `query:"at,unix"`
+		Tags []string  `query:"tags"`
+	}{At: at, Tags: []string{"x", "y"}}, url.Values{"at": {"946684800"}, "tags": {"x", "y"}})
+
+	_, err := Values(S{Strings: customEncodedStrings{"err"}})
+	if err == nil {
+		t.Error("Values() returned no error for a failing Encoder")
+	}
+}
+
+type benchStruct struct {
+	A string    `query:"a"`
+	B int       `query:"b,omitempty"`
+	C bool      `query:"c,int"`
+	D []string  `query:"d,comma"`
+	E time.Time `query:"e" layout:"2006-01-02"`
+	F string    `query:"f,omitempty"`
+	G int64     `query:"g"`
+	H float64   `query:"h"`
+	I []int     `query:"i" del:"|"`
+	J string    `url:"j"`
+	K string    `query:"k,lower"`
+	L string    `query:"l"`
+	M uint      `query:"m"`
+	N string    `query:"n"`
+	O string    `query:"o"`
+	P string    `query:"p"`
+}
+
+func BenchmarkValues_Struct(b *testing.B) {
+	v := benchStruct{
+		A: "a", B: 1, C: true, D: []string{"x", "y"},
+		E: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		I: []int{1, 2}, K: "K",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Values(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	emptierType = reflect.TypeOf(new(Emptier)).Elem()
+	errorType   = reflect.TypeOf(new(error)).Elem()
+)
+
+// flatOptions are the options a flat field may have, any other option is
+// left to the general encoding.
+var flatOptions = map[string]bool{
+	"omitempty": true,
+	"int":       true,
+	"yesno":     true,
+	"onoff":     true,
+	"lower":     true,
+	"upper":     true,
+}
+
+// flatField is a string, integer or bool field encoded by encodeFlat.
+type flatField struct {
+	index     int
+	name      string
+	omitempty bool
+	// true and false are the encoding of a bool
+	true, false string
+	// fold is strings.ToLower or strings.ToUpper for a string, if set
+	fold func(string) string
+}
+
+// flatFields returns the fields of a flat struct, nil if any field needs the
+// general encoding: a field that is not a string, integer or bool, embedded,
+// of a type with custom encoding or with other options than flatOptions.
+func flatFields(fields []field) []flatField {
+	if len(fields) == 0 {
+		return nil
+	}
+	flat := make([]flatField, 0, len(fields))
+	for _, f := range fields {
+		if f.sf.Anonymous || !flatType(f.sf.Type) {
+			return nil
+		}
+		for option := range f.opts.kvs {
+			if !flatOptions[option] {
+				return nil
+			}
+		}
+
+		ff := flatField{
+			index:     f.index,
+			name:      f.name,
+			omitempty: f.opts.contains("omitempty"),
+			true:      "true",
+			false:     "false",
+		}
+		if ff.name == "" {
+			ff.name = f.sf.Name
+		}
+		switch {
+		case f.opts.contains("int"):
+			ff.true, ff.false = "1", "0"
+		case f.opts.contains("yesno"):
+			ff.true, ff.false = "yes", "no"
+		case f.opts.contains("onoff"):
+			ff.true, ff.false = "on", "off"
+		}
+		if f.opts.contains("lower") {
+			ff.fold = strings.ToLower
+		} else if f.opts.contains("upper") {
+			ff.fold = strings.ToUpper
+		}
+		flat = append(flat, ff)
+	}
+	return flat
+}
+
+// flatType reports whether t is a string, integer or bool that the general
+// encoding formats with fmt.Sprint, without a method changing its encoding.
+func flatType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return false
+	}
+	for _, it := range []reflect.Type{encoderType, valuerType, emptierType, stringerType, errorType} {
+		if t.Implements(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeFlat encodes the fields of a flat struct as the general encoding
+// does, without its per-field type checks.
+func encodeFlat(values valueAdder, val reflect.Value, scope string, fields []flatField) {
+	for _, f := range fields {
+		sv := val.Field(f.index)
+
+		var s string
+		switch sv.Kind() {
+		case reflect.String:
+			s = sv.String()
+			if f.omitempty && s == "" {
+				continue
+			}
+			if f.fold != nil {
+				s = f.fold(s)
+			}
+		case reflect.Bool:
+			b := sv.Bool()
+			if f.omitempty && !b {
+				continue
+			}
+			s = f.false
+			if b {
+				s = f.true
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := sv.Int()
+			if f.omitempty && n == 0 {
+				continue
+			}
+			s = strconv.FormatInt(n, 10)
+		default:
+			n := sv.Uint()
+			if f.omitempty && n == 0 {
+				continue
+			}
+			s = strconv.FormatUint(n, 10)
+		}
+
+		name := f.name
+		if scope != "" {
+			name = scope + "[" + name + "]"
+		}
+		values.Add(name, s)
+	}
+}
@@ -0,0 +1,160 @@
+package query
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type flatState int
+
+type flatParams struct {
+	Name    string    `query:"name"`
+	Page    int       `query:"page,omitempty"`
+	PerPage uint16    `query:"per_page"`
+	Offset  int64     `url:"offset"`
+	Active  bool      `query:"active,int"`
+	Draft   bool      `query:"draft,yesno,omitempty"`
+	Notify  bool      `query:"notify,onoff"`
+	Sort    string    `query:"sort,lower"`
+	Order   string    `query:"order,upper,omitempty"`
+	State   flatState `query:"state"`
+	Plain   string
+	Skip    string `query:"-"`
+	private string
+}
+
+// generalValues encodes v without the fast path.
+func generalValues(t testing.TB, v any, scope string) url.Values {
+	values := make(url.Values)
+	val := reflect.ValueOf(v)
+	if err := reflectFields(values, val, scope, 0, cachedFields(val.Type()).list); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestValues_Flat(t *testing.T) {
+	tests := []flatParams{
+		{},
+		{
+			Name: "acme", Page: 2, PerPage: 100, Offset: -1,
+			Active: true, Draft: true, Notify: true,
+			Sort: "Created_AT", Order: "desc", State: 3,
+			Plain: "plain", Skip: "skip", private: "private",
+		},
+	}
+	if cachedFields(reflect.TypeOf(flatParams{})).flat == nil {
+		t.Fatal("flatParams is not flat")
+	}
+
+	for _, tt := range tests {
+		got, err := Values(tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(generalValues(t, tt, ""), got); diff != "" {
+			t.Errorf("Values(%#v) mismatch with the general encoding:\n%s", tt, diff)
+		}
+
+		// nested, scoped
+		got, err = Values(struct {
+			P flatParams `query:"p"`
+		}{tt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(generalValues(t, tt, "p"), got); diff != "" {
+			t.Errorf("Values(%#v) nested mismatch with the general encoding:\n%s", tt, diff)
+		}
+	}
+
+	// the field order is kept
+	ordered, err := ValuesOrdered(flatParams{Name: "acme", Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "name=acme&page=1&per_page=0&offset=0&active=0&notify=off&sort=&state=0&Plain="
+	if got := ordered.Encode(); got != want {
+		t.Errorf("ValuesOrdered().Encode() = %q, want %q", got, want)
+	}
+}
+
+type flatStringer int
+
+func (s flatStringer) String() string { return "stringer" }
+
+type flatEmptier string
+
+func (e flatEmptier) IsEmpty() bool { return e == "none" }
+
+type flatEmbedded struct {
+	A string `query:"a"`
+}
+
+func TestFlatFields(t *testing.T) {
+	tests := []struct {
+		input any
+		flat  bool
+	}{
+		{struct {
+			A string `query:"a"`
+			B int    `query:"b,omitempty"`
+		}{}, true},
+		{struct{}{}, false},
+		{struct {
+			F float64 `query:"f"`
+		}{}, false},
+		{struct {
+			S flatStringer `query:"s"`
+		}{}, false},
+		{struct {
+			E flatEmptier `query:"e,omitempty"`
+		}{}, false},
+		{struct {
+			V customEncodedInt `query:"v"`
+		}{}, false},
+		{struct {
+			A string `query:"a,comma"`
+		}{}, false},
+		{struct {
+			flatEmbedded
+		}{}, false},
+		{struct {
+			P *string `query:"p"`
+		}{}, false},
+	}
+
+	for _, tt := range tests {
+		typ := reflect.TypeOf(tt.input)
+		if flat := cachedFields(typ).flat != nil; flat != tt.flat {
+			t.Errorf("flat %v = %t, want %t", typ, flat, tt.flat)
+		}
+	}
+
+	// the custom encodings are kept
+	testValue(t, struct {
+		S flatStringer `query:"s"`
+		E flatEmptier  `query:"e,omitempty"`
+	}{S: 1, E: "none"}, url.Values{"s": {"stringer"}})
+}
+
+func BenchmarkValues_Flat(b *testing.B) {
+	v := flatParams{Name: "acme", Page: 2, PerPage: 100, Active: true, Sort: "Created", State: 1}
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Values(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("general", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			generalValues(b, v, "")
+		}
+	})
+}
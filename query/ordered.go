@@ -0,0 +1,132 @@
+package query
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// KeyValue is a single URL parameter.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// OrderedValues is like url.Values but keeps the parameters in the order
+// they were added, for signature schemes that depend on the submission order.
+type OrderedValues []KeyValue
+
+// Add appends the value to key.
+func (o *OrderedValues) Add(key, value string) {
+	*o = append(*o, KeyValue{Key: key, Value: value})
+}
+
+// Get gets the first value associated with the given key.
+func (o OrderedValues) Get(key string) string {
+	for _, kv := range o {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
+
+// Values returns the url.Values of o, the order of values of the same key is kept.
+func (o OrderedValues) Values() url.Values {
+	values := make(url.Values, len(o))
+	for _, kv := range o {
+		values.Add(kv.Key, kv.Value)
+	}
+	return values
+}
+
+// Encode encodes the values into "URL encoded" form ("bar=baz&foo=quux")
+// in insertion order.
+func (o OrderedValues) Encode() string {
+	var buf strings.Builder
+	for _, kv := range o {
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(url.QueryEscape(kv.Key))
+		buf.WriteByte('=')
+		buf.WriteString(url.QueryEscape(kv.Value))
+	}
+	return buf.String()
+}
+
+// ValuesOrdered returns the OrderedValues encoding of v, using the same rules
+// as Values. Struct fields and slice elements keep their declaration order,
+// map keys are sorted, as are the keys of url.Values input.
+func ValuesOrdered(v interface{}) (OrderedValues, error) {
+	values := OrderedValues{}
+
+	if v == nil {
+		return values, nil
+	}
+
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return values, nil
+		}
+		val = val.Elem()
+	}
+
+	switch str := val.Interface().(type) {
+	case string:
+		return parseOrderedQueryString(str)
+	case []byte:
+		return parseOrderedQueryString(string(str))
+	case url.Values:
+		return orderedFromValues(str), nil
+	}
+
+	err := reflectValue(&values, val)
+	return values, err
+}
+
+// EncodeOrdered returns the "URL encoded" form of v, keeping the insertion order
+// of the parameters, see ValuesOrdered.
+func EncodeOrdered(v interface{}) (string, error) {
+	values, err := ValuesOrdered(v)
+	if err != nil {
+		return "", err
+	}
+	return values.Encode(), nil
+}
+
+func orderedFromValues(uv url.Values) OrderedValues {
+	keys := make([]string, 0, len(uv))
+	for k := range uv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := OrderedValues{}
+	for _, k := range keys {
+		for _, v := range uv[k] {
+			values.Add(k, v)
+		}
+	}
+	return values
+}
+
+func parseOrderedQueryString(queryString string) (OrderedValues, error) {
+	values := OrderedValues{}
+	// validate the same way as url.ParseQuery
+	if _, err := parseQueryString(queryString); err != nil {
+		return values, err
+	}
+	for _, pair := range strings.Split(strings.TrimLeft(queryString, "?"), "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, _ = url.QueryUnescape(key)
+		value, _ = url.QueryUnescape(value)
+		values.Add(key, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValuesOrdered(t *testing.T) {
+	type Sub struct {
+		Z string `query:"z"`
+		A string `query:"a"`
+	}
+
+	tests := []struct {
+		input interface{}
+		want  OrderedValues
+	}{
+		// zero values
+		{input: nil, want: OrderedValues{}},
+		{input: "", want: OrderedValues{}},
+
+		// query string order is kept
+		{
+			input: "z=1&a=2&z=3",
+			want:  OrderedValues{{"z", "1"}, {"a", "2"}, {"z", "3"}},
+		},
+		// url.Values are sorted by key
+		{
+			input: url.Values{"z": {"1", "3"}, "a": {"2"}},
+			want:  OrderedValues{{"a", "2"}, {"z", "1"}, {"z", "3"}},
+		},
+		// maps are sorted by key
+		{
+			input: map[string]interface{}{"z": 1, "a": 2, "m": []string{"x", "y"}},
+			want:  OrderedValues{{"a", "2"}, {"m", "x"}, {"m", "y"}, {"z", "1"}},
+		},
+		// struct fields keep their declaration order, including repeated keys
+		{
+			input: struct {
+				B   string   `query:"b"`
+				A   []string `query:"a"`
+				C   string   `query:"a"`
+				Sub Sub      `query:"sub"`
+			}{
+				B:   "1",
+				A:   []string{"y", "x"},
+				C:   "z",
+				Sub: Sub{Z: "2", A: "3"},
+			},
+			want: OrderedValues{{"b", "1"}, {"a", "y"}, {"a", "x"}, {"a", "z"}, {"sub[z]", "2"}, {"sub[a]", "3"}},
+		},
+		// custom encoders
+		{
+			input: struct {
+				V customEncodedStrings `query:"v"`
+			}{customEncodedStrings{"a", "b"}},
+			want: OrderedValues{{"v.0", "a"}, {"v.1", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ValuesOrdered(tt.input)
+		if err != nil {
+			t.Errorf("ValuesOrdered(%q) returned error: %v", tt.input, err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ValuesOrdered(%#v) mismatch:\n%s", tt.input, diff)
+		}
+	}
+}
+
+func TestEncodeOrdered(t *testing.T) {
+	input := struct {
+		Timestamp int      `query:"timestamp"`
+		Nonce     string   `query:"nonce"`
+		Tags      []string `query:"tag"`
+		AppID     string   `query:"app_id"`
+	}{
+		Timestamp: 1700000000,
+		Nonce:     "a b",
+		Tags:      []string{"z", "a"},
+		AppID:     "app",
+	}
+
+	got, err := EncodeOrdered(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "timestamp=1700000000&nonce=a+b&tag=z&tag=a&app_id=app"
+	if got != want {
+		t.Errorf("EncodeOrdered() = %q, want %q", got, want)
+	}
+
+	values, err := ValuesOrdered(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(url.Values{
+		"timestamp": {"1700000000"},
+		"nonce":     {"a b"},
+		"tag":       {"z", "a"},
+		"app_id":    {"app"},
+	}, values.Values()); diff != "" {
+		t.Errorf("Values() mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,76 @@
+package ghttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// epochThreshold separates a reset given as epoch seconds from one given as
+// seconds until the reset, no window lasts more than a year.
+const epochThreshold = 365 * 24 * 60 * 60
+
+// RateLimitInfo is the rate limit state reported by the server.
+type RateLimitInfo struct {
+	// Limit is the number of requests allowed in the window, -1 if unknown.
+	Limit int
+	// Remaining is the number of requests left in the window, -1 if unknown.
+	Remaining int
+	// Reset is when the window resets, zero if unknown.
+	Reset time.Time
+}
+
+// ParseRateLimit parses the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, falling back to RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset. The reset may be given as epoch
+// seconds or as seconds until the reset. It reports false if none is present.
+func ParseRateLimit(header http.Header) (RateLimitInfo, bool) {
+	info := RateLimitInfo{Limit: -1, Remaining: -1}
+	found := false
+
+	if v, ok := rateLimitHeader(header, "Limit"); ok {
+		info.Limit, found = int(v), true
+	}
+	if v, ok := rateLimitHeader(header, "Remaining"); ok {
+		info.Remaining, found = int(v), true
+	}
+	if v, ok := rateLimitHeader(header, "Reset"); ok {
+		if v >= epochThreshold {
+			info.Reset = time.Unix(v, 0)
+		} else {
+			info.Reset = time.Now().Add(time.Duration(v) * time.Second)
+		}
+		found = true
+	}
+	return info, found
+}
+
+func rateLimitHeader(header http.Header, name string) (int64, bool) {
+	for _, key := range []string{"X-RateLimit-" + name, "RateLimit-" + name} {
+		s := header.Get(key)
+		if s == "" {
+			continue
+		}
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v >= 0 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// CaptureRateLimit stores the rate limit headers of the response into info,
+// info is left unchanged if the response has none:
+//
+//	var rl ghttp.RateLimitInfo
+//	_, err := client.Invoke(ctx, http.MethodGet, "/api/v4/projects", nil, &reply, ghttp.CaptureRateLimit(&rl))
+//	if rl.Remaining == 0 {
+//	    time.Sleep(time.Until(rl.Reset))
+//	}
+func CaptureRateLimit(info *RateLimitInfo) CallOption {
+	return After(func(response *http.Response) error {
+		if v, ok := ParseRateLimit(response.Header); ok {
+			*info = v
+		}
+		return nil
+	})
+}
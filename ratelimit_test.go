@@ -0,0 +1,97 @@
+package ghttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   RateLimitInfo
+		wantOk bool
+		delta  time.Duration
+	}{
+		{
+			name:   "none",
+			want:   RateLimitInfo{Limit: -1, Remaining: -1},
+			wantOk: false,
+		},
+		{
+			name: "epoch seconds",
+			header: map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "4999",
+				"X-RateLimit-Reset":     "1700000000",
+			},
+			want:   RateLimitInfo{Limit: 5000, Remaining: 4999, Reset: time.Unix(1700000000, 0)},
+			wantOk: true,
+		},
+		{
+			name: "delta seconds",
+			header: map[string]string{
+				"RateLimit-Limit":     "100",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "30",
+			},
+			want:   RateLimitInfo{Limit: 100, Remaining: 0},
+			wantOk: true,
+			delta:  30 * time.Second,
+		},
+		{
+			name: "invalid",
+			header: map[string]string{
+				"X-RateLimit-Remaining": "abc",
+				"X-RateLimit-Limit":     "10",
+			},
+			want:   RateLimitInfo{Limit: 10, Remaining: -1},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			start := time.Now()
+			got, ok := ParseRateLimit(header)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got.Limit != tt.want.Limit || got.Remaining != tt.want.Remaining {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if tt.delta > 0 {
+				if got.Reset.Before(start.Add(tt.delta)) || got.Reset.After(time.Now().Add(tt.delta)) {
+					t.Errorf("Reset = %v, want about %v from now", got.Reset, tt.delta)
+				}
+			} else if !got.Reset.Equal(tt.want.Reset) {
+				t.Errorf("Reset = %v, want %v", got.Reset, tt.want.Reset)
+			}
+		})
+	}
+}
+
+func TestCaptureRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "59")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+	}))
+	defer srv.Close()
+
+	var rl RateLimitInfo
+	c := NewClient(WithEndpoint(srv.URL))
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil, CaptureRateLimit(&rl)); err != nil {
+		t.Fatal(err)
+	}
+	want := RateLimitInfo{Limit: 60, Remaining: 59, Reset: time.Unix(1700000000, 0)}
+	if rl.Limit != want.Limit || rl.Remaining != want.Remaining || !rl.Reset.Equal(want.Reset) {
+		t.Errorf("got %+v, want %+v", rl, want)
+	}
+}
@@ -0,0 +1,269 @@
+package ghttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// retryable reports whether a failed attempt can be retried: transient
+// network errors, 429 Too Many Requests and 5xx responses, as long as ctx is
+// not done.
+func retryable(ctx context.Context, response *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return transient(err)
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// transient reports whether err is a transport error that may not happen
+// again: a connection refused, reset or closed early, or a timeout, e.g. of
+// WithPerAttemptTimeout. An error of the response, e.g. a corrupt
+// Content-Encoding, an unsupported scheme, an unknown host or a failed TLS
+// verification is not.
+func transient(err error) bool {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+
+	var (
+		certErr *tls.CertificateVerificationError
+		dnsErr  *net.DNSError
+	)
+	switch {
+	case errors.As(err, &certErr):
+		return false
+	case errors.As(err, &dnsErr):
+		return !dnsErr.IsNotFound
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+type attemptKey struct{}
+
+// AttemptFromContext returns the attempt number, starting at 1, of the
+// request whose context is ctx, e.g. in a DebugInterface, a transport or
+// from response.Request in CallOption.After. It returns 0 if ctx is not the
+// context of an attempt.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// streamKey marks the context of a request whose body is streamed for as
+// long as the request context allows, by SSE and DownloadToFile.
+type streamKey struct{}
+
+// withStream marks req as streamed, its attempts are not bounded by
+// WithPerAttemptTimeout, which would cut the body off.
+func withStream(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), streamKey{}, true))
+}
+
+// rewindable reports whether the body of req can be sent again.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// idempotent reports whether sending req again cannot duplicate a write:
+// GET, HEAD, OPTIONS, TRACE, PUT and DELETE, or a request with an
+// Idempotency-Key header.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// RetryNonIdempotent lets WithRetry retry a request whose method is not
+// idempotent, e.g. a POST or a PATCH without Idempotency-Key header, which
+// may duplicate the write if the server processed a failed attempt:
+//
+//	client.Invoke(ctx, http.MethodPost, "/counters/1/incr", nil, &reply, ghttp.RetryNonIdempotent())
+func RetryNonIdempotent() CallOption {
+	return retryNonIdempotentCallOption{}
+}
+
+type retryNonIdempotentCallOption struct{}
+
+func (retryNonIdempotentCallOption) Before(request *http.Request) error {
+	return nil
+}
+
+func (retryNonIdempotentCallOption) After(response *http.Response) error {
+	return nil
+}
+
+// hasRetryNonIdempotent reports whether opts, including the options composed
+// with NewCallOptions, contain RetryNonIdempotent.
+func hasRetryNonIdempotent(opts []CallOption) bool {
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case retryNonIdempotentCallOption:
+			return true
+		case *CallOptions:
+			if hasRetryNonIdempotent(o.opts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendAttempts sends req, retrying as configured by WithRetry. Each attempt
+// is bounded by WithPerAttemptTimeout, but for a stream, the request context
+// bounds the total.
+// A request that is not idempotent is only retried with retryAll.
+func (c *Client) sendAttempts(req *http.Request, retryAll bool) (*http.Response, error) {
+	maxAttempts := c.opts.retryAttempts
+	if maxAttempts < 1 || !rewindable(req) || !(retryAll || idempotent(req)) {
+		// a body that cannot be rewound, e.g. a pipe, is sent once, as is
+		// a request that is not idempotent without RetryNonIdempotent
+		maxAttempts = 1
+	}
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		ctx := context.WithValue(req.Context(), attemptKey{}, attempt)
+		cancel := context.CancelFunc(func() {})
+		if streamed, _ := req.Context().Value(streamKey{}).(bool); c.opts.perAttemptTimeout > 0 && !streamed {
+			ctx, cancel = withTimeout(ctx, c.opts.clock, c.opts.perAttemptTimeout)
+		}
+		// shallow copy, so that the attempt does not alter req
+		attemptReq = attemptReq.WithContext(ctx)
+
+		response, err := c.roundTrip(attemptReq)
+		retry := attempt < maxAttempts && retryable(req.Context(), response, err)
+		if retry {
+			// rewind the body before the result is discarded, if it fails
+			// the result is returned rather than retried with an empty body
+			next, cloneErr := CloneRequest(req)
+			if cloneErr != nil {
+				retry = false
+			}
+			attemptReq = next
+		}
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			if response.StatusCode == http.StatusSwitchingProtocols {
+				// the body is the upgraded connection, left as is and
+				// no longer bounded by the attempt deadline
+				cancel()
+				return response, nil
+			}
+			// the attempt deadline also bounds reading the body
+			response.Body = &cancelReadCloser{ReadCloser: response.Body, cancel: cancel}
+			return response, nil
+		}
+
+		if response != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+		cancel()
+
+		if err = sleep(req.Context(), c.opts.clock, c.opts.retryBackoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends a single attempt, with debugging.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	debugger := c.debugger()
+
+	if debugger != nil {
+		debugger.Before(req)
+	}
+
+	stats := transferStatsFrom(req.Context())
+	if stats != nil {
+		// the counts are of the last attempt
+		stats.sent.Store(0)
+		stats.received.Store(0)
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = newCountingReadCloser(req.Body, &stats.sent)
+		}
+	}
+
+	var (
+		response *http.Response
+		err      error
+	)
+	if c.opts.dryRun != nil {
+		response = c.dryRunResponse(req)
+	} else {
+		response, err = c.hc.Do(req)
+	}
+	// the body of a 101 is the upgraded connection, left as is
+	if err == nil && stats != nil && response.StatusCode != http.StatusSwitchingProtocols {
+		response.Body = newCountingReadCloser(response.Body, &stats.received)
+	}
+	if err == nil && len(c.opts.acceptEncoding) > 0 {
+		if err = decodeContentEncoding(response); err != nil {
+			_ = response.Body.Close()
+			response = nil
+		}
+	}
+	if debugger != nil {
+		debugger.After(req, response, err)
+	}
+	if l, ok := c.opts.limiter.(ResponseAwareLimiter); ok && err == nil {
+		l.Observe(response.StatusCode)
+	}
+	return response, err
+}
+
+// dryRunResponse calls the WithDryRun function with req and returns an empty
+// 200 OK response. It closes the body of req once the function returns, as a
+// transport does.
+func (c *Client) dryRunResponse(req *http.Request) *http.Response {
+	c.opts.dryRun(req)
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// cancelReadCloser cancels the context of the request when the body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
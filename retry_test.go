@@ -0,0 +1,383 @@
+package ghttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithRetry(3, time.Millisecond),
+	)
+	var reply struct {
+		Name string `json:"name"`
+	}
+	if _, err := c.Invoke(context.Background(), http.MethodPut, "/", map[string]string{"name": "acme"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+	if reply.Name != "acme" {
+		t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+	}
+}
+
+func TestWithRetry_TransientErrors(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/dropped":
+			// the first connection is closed without a response
+			if n == 1 {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					_ = conn.Close()
+				}
+				return
+			}
+		case "/corrupt":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write([]byte("not gzip"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithRetry(3, time.Millisecond), WithAcceptEncoding("gzip"))
+	tests := []struct {
+		path     string
+		wantErr  bool
+		requests int32
+	}{
+		{"/dropped", false, 2},
+		// a corrupt body is not retried
+		{"/corrupt", true, 1},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		_, err := c.Invoke(context.Background(), http.MethodGet, tt.path, nil, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Invoke() error = %v, want error %t", tt.path, err, tt.wantErr)
+		}
+		if n := atomic.LoadInt32(&requests); n != tt.requests {
+			t.Errorf("%s: requests = %d, want %d", tt.path, n, tt.requests)
+		}
+	}
+}
+
+func TestWithRetry_TLSVerification(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the certificate of the server is not trusted
+	c := NewClient(WithEndpoint(srv.URL), WithRetry(3, time.Millisecond))
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		t.Fatalf("Invoke() error = %v, want *tls.CertificateVerificationError", err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("connections = %d, want 1", n)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eof", wrap(io.EOF), true},
+		{"reset", wrap(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), true},
+		{"refused", wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), true},
+		{"attempt timeout", wrap(context.DeadlineExceeded), true},
+		{"unsupported scheme", wrap(errors.New(`unsupported protocol scheme "ftp"`)), false},
+		{"unknown host", wrap(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}), false},
+		{"tls verification", wrap(&tls.CertificateVerificationError{Err: errors.New("unknown authority")}), false},
+		{"not a transport error", io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		if got := transient(tt.err); got != tt.want {
+			t.Errorf("%s: transient(%v) = %t, want %t", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithPerAttemptTimeout(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// hang until the attempt is canceled
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"acme"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithTimeout(2*time.Second),
+		WithRetry(2, 0),
+		WithPerAttemptTimeout(100*time.Millisecond),
+	)
+
+	start := time.Now()
+	var reply struct {
+		Name string `json:"name"`
+	}
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Invoke() took %s, want the first attempt to time out after 100ms", elapsed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+	if reply.Name != "acme" {
+		t.Errorf("reply.Name = %q, want %q", reply.Name, "acme")
+	}
+}
+
+func TestWithRetry_UnknownLength(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if len(r.TransferEncoding) != 1 || r.TransferEncoding[0] != "chunked" {
+			t.Errorf("TransferEncoding = %v, want chunked", r.TransferEncoding)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "chunk 1\nchunk 2\n" {
+			t.Errorf("body = %q", body)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pw, "chunk 1\n")
+		_, _ = io.WriteString(pw, "chunk 2\n")
+		_ = pw.Close()
+	}()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SetRequestBody(req, pr); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	c := NewClient(WithRetry(3, time.Millisecond), WithDebugWriter(&buf), WithDebug(true))
+	response, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1, the body cannot be rewound", n)
+	}
+}
+
+func TestWithRetry_NonIdempotent(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithRetry(3, time.Millisecond))
+	tests := []struct {
+		name   string
+		method string
+		opts   []CallOption
+		want   int32
+	}{
+		{name: "post", method: http.MethodPost, want: 1},
+		{name: "patch", method: http.MethodPatch, want: 1},
+		{name: "delete", method: http.MethodDelete, want: 3},
+		{
+			name:   "idempotency key",
+			method: http.MethodPost,
+			opts:   []CallOption{Before(func(r *http.Request) error { r.Header.Set("Idempotency-Key", "k1"); return nil })},
+			want:   3,
+		},
+		{name: "opt-in", method: http.MethodPost, opts: []CallOption{RetryNonIdempotent()}, want: 3},
+		{name: "opt-in composed", method: http.MethodPost, opts: []CallOption{NewCallOptions(RetryNonIdempotent())}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			response, err := c.Invoke(context.Background(), tt.method, "/", map[string]string{"name": "acme"}, nil, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+			if n := atomic.LoadInt32(&requests); n != tt.want {
+				t.Errorf("requests = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry_NotRewindable(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Error("retried with an empty body")
+		}
+		// fail with a network error
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithRetry(3, time.Millisecond))
+
+	// streaming body without GetBody
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pw, "data")
+		_ = pw.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, pr)
+	_, err := c.Do(req)
+	if err == nil || strings.Contains(err.Error(), "rewindable") {
+		t.Errorf("Do() error = %v, want the original error", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+
+	// GetBody fails to rewind the stream
+	atomic.StoreInt32(&requests, 0)
+	req, _ = http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("data"))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return nil, errors.New("stream cannot be rewound")
+	}
+	_, err = c.Do(req)
+	if err == nil || strings.Contains(err.Error(), "rewound") {
+		t.Errorf("Do() error = %v, want the original error", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+// attemptDebugger records the attempt number of every request it sees.
+type attemptDebugger struct {
+	attempts *[]int
+}
+
+func (d attemptDebugger) Before(request *http.Request) {
+	*d.attempts = append(*d.attempts, AttemptFromContext(request.Context()))
+}
+
+func (d attemptDebugger) After(request *http.Request, response *http.Response, err error) {}
+
+type attemptTransport struct {
+	attempts *[]int
+}
+
+func (t attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	*t.attempts = append(*t.attempts, AttemptFromContext(req.Context()))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAttemptFromContext(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var attempts, transportAttempts []int
+	c := NewClient(
+		WithEndpoint(srv.URL),
+		WithRetry(3, time.Millisecond),
+		WithTransport(attemptTransport{attempts: &transportAttempts}),
+		WithDebug(true),
+		WithDebugInterface(func() DebugInterface {
+			return attemptDebugger{attempts: &attempts}
+		}),
+	)
+
+	var last int
+	_, err := c.Invoke(context.Background(), http.MethodPut, "/", map[string]string{"name": "acme"}, nil,
+		After(func(response *http.Response) error {
+			last = AttemptFromContext(response.Request.Context())
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{1, 2, 3}
+	if !reflect.DeepEqual(attempts, want) {
+		t.Errorf("debugger attempts = %v, want %v", attempts, want)
+	}
+	if !reflect.DeepEqual(transportAttempts, want) {
+		t.Errorf("transport attempts = %v, want %v", transportAttempts, want)
+	}
+	if last != 3 {
+		t.Errorf("After attempt = %d, want 3", last)
+	}
+	if got := AttemptFromContext(context.Background()); got != 0 {
+		t.Errorf("AttemptFromContext(context.Background()) = %d, want 0", got)
+	}
+}
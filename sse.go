@@ -0,0 +1,136 @@
+package ghttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentTypeEventStream is the content type of Server-Sent Events.
+const ContentTypeEventStream = "text/event-stream"
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID is the last event ID of the stream, it is kept by the following
+	// events until the server sets another one.
+	ID string
+	// Event is the event type, "message" if not set by the server.
+	Event string
+	// Data is the data of the event, the lines of multiple data fields are
+	// joined with "\n".
+	Data string
+	// Retry is the reconnection time requested by the server, zero if not set.
+	Retry time.Duration
+}
+
+// SSE sends a GET request with Accept: text/event-stream and calls onEvent
+// for every event of the stream as it is received, without buffering the
+// body. It returns nil when the server closes the stream, the error of
+// onEvent, which stops reading, or the error of ctx when it is done.
+//
+// The stream is bounded by ctx only, neither the client timeout nor
+// WithPerAttemptTimeout applies.
+func (c *Client) SSE(ctx context.Context, path string, onEvent func(Event) error, opts ...CallOption) error {
+	req, _, err := c.newRequest(ctx, http.MethodGet, path, nil, false)
+	if err != nil {
+		return err
+	}
+	req = withStream(req)
+	if err = c.wait(req); err != nil {
+		return err
+	}
+
+	response, err := c.do(req, append([]CallOption{Accept(ContentTypeEventStream)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if !c.isSuccess(response.StatusCode) {
+		return newError(req, response, fmt.Errorf("sse: unexpected status %s", response.Status))
+	}
+
+	// close the body to interrupt a blocked read when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = response.Body.Close()
+	})
+	defer stop()
+
+	err = readEvents(response.Body, onEvent)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// readEvents parses the event stream of r as specified by the HTML Living
+// Standard, an event is dispatched on an empty line.
+func readEvents(r io.Reader, onEvent func(Event) error) error {
+	br := bufio.NewReader(r)
+
+	var (
+		event Event
+		data  strings.Builder
+		// hasData is set by a data field, even with an empty value
+		hasData bool
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// an incomplete event is discarded
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if hasData {
+				event.Data = data.String()
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if err := onEvent(event); err != nil {
+					return err
+				}
+			}
+			// the last event ID is kept
+			event = Event{ID: event.ID}
+			data.Reset()
+			hasData = false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, e.g. a keep-alive
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				event.ID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
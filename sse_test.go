@@ -0,0 +1,127 @@
+package ghttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_SSE(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != ContentTypeEventStream {
+			t.Errorf("Accept = %q, want %q", accept, ContentTypeEventStream)
+		}
+		w.Header().Set("Content-Type", ContentTypeEventStream)
+		for _, chunk := range []string{
+			": keep-alive\n\n",
+			"id: 1\ndata: hello\n\n",
+			"event: update\r\ndata: line 1\r\ndata: line 2\r\nretry: 3000\r\n\r\n",
+			"data\n\n",
+			"event: ignored\n\n",
+			"data: incomplete",
+		} {
+			_, _ = io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var events []Event
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(time.Millisecond))
+	err := c.SSE(context.Background(), "/events", func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{ID: "1", Event: "message", Data: "hello"},
+		{ID: "1", Event: "update", Data: "line 1\nline 2", Retry: 3 * time.Second},
+		{ID: "1", Event: "message", Data: ""},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestClient_SSE_PerAttemptTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeEventStream)
+		for i := 0; i < 3; i++ {
+			_, _ = io.WriteString(w, "data: tick\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	// the stream outlives an attempt
+	var events int
+	c := NewClient(WithEndpoint(srv.URL), WithPerAttemptTimeout(20*time.Millisecond))
+	err := c.SSE(context.Background(), "/events", func(e Event) error {
+		events++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events != 3 {
+		t.Errorf("events = %d, want 3", events)
+	}
+}
+
+func TestClient_SSE_Cancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeEventStream)
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithDebug(true), WithDebugWriter(io.Discard))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := c.SSE(ctx, "/events", func(e Event) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SSE() error = %v, want context.Canceled", err)
+	}
+
+	errStop := errors.New("stop")
+	err = c.SSE(context.Background(), "/events", func(e Event) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("SSE() error = %v, want %v", err, errStop)
+	}
+}
+
+func TestClient_SSE_Status(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := NewClient(WithEndpoint(srv.URL)).SSE(context.Background(), "/events", func(e Event) error {
+		t.Error("unexpected event")
+		return nil
+	})
+	if code, ok := StatusForErr(err); !ok || code != http.StatusUnauthorized {
+		t.Errorf("StatusForErr() = %d, %t, want %d, true", code, ok, http.StatusUnauthorized)
+	}
+	if err == nil || !strings.Contains(err.Error(), "sse: unexpected status") {
+		t.Errorf("SSE() error = %v", err)
+	}
+}
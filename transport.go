@@ -0,0 +1,142 @@
+package ghttp
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var warnInsecureOnce sync.Once
+
+// netDialer returns the dialer configured by the transport-tuning options,
+// created with the defaults of http.DefaultTransport.
+func (c *clientOptions) netDialer() *net.Dialer {
+	if c.dialer == nil {
+		c.dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+	}
+	return c.dialer
+}
+
+// buildTransport applies the transport-tuning options to a clone of the
+// transport, so that neither http.DefaultTransport nor a transport passed to
+// WithTransport is modified. Other RoundTrippers are returned as-is.
+func (c *clientOptions) buildTransport() http.RoundTripper {
+	if c.tlsConf == nil && c.proxy == nil && c.dialer == nil && !c.forceHTTP1 && len(c.tlsByHost) == 0 &&
+		len(c.clientCerts) == 0 && c.rootCAs == nil && !c.insecureSkipVerify && c.maxHeaderBytes == 0 {
+		return c.transport
+	}
+	tr, ok := c.transport.(*http.Transport)
+	if !ok {
+		return c.transport
+	}
+
+	tr = tr.Clone()
+	if c.tlsConf != nil {
+		tr.TLSClientConfig = c.tlsConf
+	}
+	if len(c.clientCerts) > 0 || c.rootCAs != nil || c.insecureSkipVerify {
+		cfg := &tls.Config{}
+		if tr.TLSClientConfig != nil {
+			cfg = tr.TLSClientConfig.Clone()
+		}
+		cfg.Certificates = append(cfg.Certificates, c.clientCerts...)
+		if c.rootCAs != nil {
+			cfg.RootCAs = c.rootCAs
+		}
+		if c.insecureSkipVerify {
+			warnInsecureOnce.Do(func() {
+				log.Println("ghttp: WARNING: TLS certificate verification is disabled by WithInsecureSkipVerify, do not use it in production")
+			})
+			cfg.InsecureSkipVerify = true
+		}
+		tr.TLSClientConfig = cfg
+	}
+	if c.proxy != nil {
+		tr.Proxy = c.proxy
+	}
+	if c.dialer != nil {
+		tr.DialContext = c.dialer.DialContext
+	}
+	if c.forceHTTP1 {
+		// a non-nil empty map disables the HTTP/2 upgrade
+		tr.ForceAttemptHTTP2 = false
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if tr.TLSClientConfig != nil {
+			// do not negotiate h2 through ALPN either
+			tr.TLSClientConfig = tr.TLSClientConfig.Clone()
+			tr.TLSClientConfig.NextProtos = withoutProto(tr.TLSClientConfig.NextProtos, "h2")
+		}
+	}
+	if c.maxHeaderBytes > 0 {
+		tr.MaxResponseHeaderBytes = c.maxHeaderBytes
+	}
+	if len(c.tlsByHost) > 0 {
+		tr.DialTLSContext = c.dialTLS(tr)
+	}
+	return tr
+}
+
+// dialTLS returns a DialTLSContext using the WithTLSConfigForHost config of
+// the host, or the TLSClientConfig of tr for the other hosts.
+func (c *clientOptions) dialTLS(tr *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	base := tr.TLSClientConfig
+	forceHTTP1 := c.forceHTTP1
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg, ok := c.tlsByHost[strings.ToLower(addr)]
+		if !ok {
+			cfg, ok = c.tlsByHost[strings.ToLower(host)]
+		}
+		if !ok {
+			cfg = base
+		}
+		if cfg == nil {
+			cfg = &tls.Config{}
+		} else {
+			cfg = cfg.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		if forceHTTP1 {
+			cfg.NextProtos = withoutProto(cfg.NextProtos, "h2")
+		}
+
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+func withoutProto(protos []string, proto string) []string {
+	var out []string
+	for _, p := range protos {
+		if p != proto {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,320 @@
+package ghttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithDualStack(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want time.Duration
+	}{
+		{name: "enabled", opts: []ClientOption{WithDualStack(true)}, want: 0},
+		{name: "disabled", opts: []ClientOption{WithDualStack(false)}, want: -1},
+		{name: "fallback delay", opts: []ClientOption{WithDualStack(true), WithFallbackDelay(50 * time.Millisecond)}, want: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(tt.opts...)
+			if c.opts.dialer == nil {
+				t.Fatal("dialer is not set")
+			}
+			if c.opts.dialer.FallbackDelay != tt.want {
+				t.Errorf("FallbackDelay = %s, want %s", c.opts.dialer.FallbackDelay, tt.want)
+			}
+			tr, ok := c.hc.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("Transport = %T, want *http.Transport", c.hc.Transport)
+			}
+			if tr == http.DefaultTransport {
+				t.Error("http.DefaultTransport was modified")
+			}
+			if tr.DialContext == nil {
+				t.Error("DialContext is not set")
+			}
+		})
+	}
+}
+
+func TestBuildTransport_Default(t *testing.T) {
+	c := NewClient()
+	if c.hc.Transport != http.DefaultTransport {
+		t.Errorf("Transport = %v, want http.DefaultTransport", c.hc.Transport)
+	}
+}
+
+func TestWithForceHTTP1(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		force bool
+		want  string
+	}{
+		{force: false, want: "HTTP/2.0"},
+		{force: true, want: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			base := srv.Client().Transport.(*http.Transport).Clone()
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithTransport(base),
+				WithForceHTTP1(tt.force),
+				WithContentType("text/plain"),
+			)
+			var reply string
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Proto != tt.want || reply != tt.want {
+				t.Errorf("Proto = %s, server saw %s, want %s", resp.Proto, reply, tt.want)
+			}
+		})
+	}
+}
+
+// newTestCert returns a self-signed certificate for 127.0.0.1 and its PEM encoding.
+func newTestCert(t *testing.T, name string) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPEM, keyPEM
+}
+
+func newTLSServer(t *testing.T, cert tls.Certificate, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWithTLSConfigForHost(t *testing.T) {
+	certA, pemA, _ := newTestCert(t, "a")
+	certB, pemB, _ := newTestCert(t, "b")
+	srvA := newTLSServer(t, certA, "a")
+	srvB := newTLSServer(t, certB, "b")
+
+	rootsA, rootsB := x509.NewCertPool(), x509.NewCertPool()
+	rootsA.AppendCertsFromPEM(pemA)
+	rootsB.AppendCertsFromPEM(pemB)
+	hostA := strings.TrimPrefix(srvA.URL, "https://")
+	hostB := strings.TrimPrefix(srvB.URL, "https://")
+
+	get := func(c *Client, url string) (string, error) {
+		var reply string
+		_, err := c.Invoke(context.Background(), http.MethodGet, url, nil, &reply)
+		return reply, err
+	}
+
+	c := NewClient(
+		WithTransport(&http.Transport{}),
+		WithContentType("text/plain"),
+		WithTLSConfigForHost(hostA, &tls.Config{RootCAs: rootsA}),
+		WithTLSConfigForHost(hostB, &tls.Config{RootCAs: rootsB}),
+	)
+	for url, want := range map[string]string{srvA.URL: "a", srvB.URL: "b"} {
+		got, err := get(c, url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		if got != want {
+			t.Errorf("GET %s = %q, want %q", url, got, want)
+		}
+	}
+
+	// the root CA of the other host is not trusted
+	swapped := NewClient(
+		WithTransport(&http.Transport{}),
+		WithContentType("text/plain"),
+		WithTLSConfigForHost(hostA, &tls.Config{RootCAs: rootsB}),
+		WithTLSConfigForHost(hostB, &tls.Config{RootCAs: rootsA}),
+	)
+	for _, url := range []string{srvA.URL, srvB.URL} {
+		if _, err := get(swapped, url); err == nil {
+			t.Errorf("GET %s with the wrong root CA: error = nil", url)
+		}
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	serverCert, serverPEM, _ := newTestCert(t, "server")
+	clientCert, clientPEM, clientKeyPEM := newTestCert(t, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientPEM)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	certFile, keyFile := write("client.pem", clientPEM), write("client-key.pem", clientKeyPEM)
+	caFile := write("ca.pem", serverPEM)
+
+	tests := []struct {
+		name string
+		cert ClientOption
+	}{
+		{name: "files", cert: WithClientCertificate(certFile, keyFile)},
+		{name: "pem", cert: WithClientCertificatePEM(clientPEM, clientKeyPEM)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(
+				WithEndpoint(srv.URL),
+				WithTransport(&http.Transport{}),
+				WithContentType("text/plain"),
+				tt.cert,
+				WithRootCAFile(caFile),
+			)
+
+			tr := c.hc.Transport.(*http.Transport)
+			if got := tr.TLSClientConfig.Certificates; len(got) != 1 || !bytes.Equal(got[0].Certificate[0], clientCert.Certificate[0]) {
+				t.Errorf("TLSClientConfig.Certificates does not carry the client certificate")
+			}
+			if tr.TLSClientConfig.RootCAs == nil {
+				t.Errorf("TLSClientConfig.RootCAs is nil")
+			}
+
+			var reply string
+			if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply != "client" {
+				t.Errorf("server saw client certificate %q, want %q", reply, "client")
+			}
+		})
+	}
+}
+
+func TestWithClientCertificate_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ClientOption
+	}{
+		{name: "missing files", opt: WithClientCertificate("missing.pem", "missing-key.pem")},
+		{name: "invalid pem", opt: WithClientCertificatePEM([]byte("cert"), []byte("key"))},
+		{name: "missing root CA", opt: WithRootCAFile("missing.pem")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(WithEndpoint("https://example.com"), tt.opt)
+			if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, nil); err == nil {
+				t.Error("Invoke() error = nil, want the option error")
+			}
+		})
+	}
+}
+
+func TestWithInsecureSkipVerify(t *testing.T) {
+	cert, _, _ := newTestCert(t, "self-signed")
+	srv := newTLSServer(t, cert, "ok")
+
+	for _, skip := range []bool{false, true} {
+		c := NewClient(WithEndpoint(srv.URL), WithContentType("text/plain"), WithInsecureSkipVerify(skip))
+		var reply string
+		_, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply)
+		if skip && (err != nil || reply != "ok") {
+			t.Errorf("WithInsecureSkipVerify(true): reply = %q, error = %v, want ok", reply, err)
+		}
+		if !skip && err == nil {
+			t.Error("WithInsecureSkipVerify(false): error = nil, want a certificate error")
+		}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport)
+	if tr.TLSClientConfig != nil && tr.TLSClientConfig.InsecureSkipVerify {
+		t.Error("http.DefaultTransport was modified")
+	}
+}
+
+func TestWithMaxResponseHeaderBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bomb" {
+			w.Header().Set("X-Bomb", strings.Repeat("a", 64<<10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithMaxResponseHeaderBytes(4<<10))
+	if tr := c.hc.Transport.(*http.Transport); tr == http.DefaultTransport || tr.MaxResponseHeaderBytes != 4<<10 {
+		t.Fatalf("MaxResponseHeaderBytes = %d, want %d on a clone", tr.MaxResponseHeaderBytes, 4<<10)
+	}
+
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/ok", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Invoke(context.Background(), http.MethodGet, "/bomb", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeded 4096 bytes") {
+		t.Errorf("Invoke() error = %v, want headers exceeded", err)
+	}
+}
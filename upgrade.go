@@ -0,0 +1,81 @@
+package ghttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// Upgrade sends a GET request with Connection: Upgrade and the Upgrade header
+// of headers, e.g. "websocket", with the transport and TLS config of the
+// client. On 101 Switching Protocols it returns the raw connection, which
+// the caller closes, other status codes are returned as an *Error.
+//
+// The handshake is bounded by ctx only, the client timeout does not apply to
+// the connection.
+func (c *Client) Upgrade(ctx context.Context, path string, headers http.Header, opts ...CallOption) (net.Conn, *http.Response, error) {
+	protocol := headers.Get("Upgrade")
+	if protocol == "" {
+		return nil, nil, errors.New("upgrade: no Upgrade header")
+	}
+
+	req, _, err := c.newRequest(ctx, http.MethodGet, path, nil, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Header.Set("Connection", "Upgrade")
+
+	// the connection carries the addresses and deadlines of the upgraded conn
+	var conn net.Conn
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn = info.Conn
+		},
+	}))
+
+	if err = c.wait(req); err != nil {
+		return nil, nil, err
+	}
+	response, err := c.do(req, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		_ = response.Body.Close()
+		return nil, response, newError(req, response, fmt.Errorf("upgrade: unexpected status %s", response.Status))
+	}
+
+	rwc, ok := response.Body.(io.ReadWriteCloser)
+	if !ok || conn == nil {
+		_ = response.Body.Close()
+		return nil, response, newError(req, response, errors.New("upgrade: the transport does not support protocol switching"))
+	}
+	return &upgradedConn{Conn: conn, rwc: rwc}, response, nil
+}
+
+// upgradedConn reads and writes through the body of the 101 response, which
+// holds the data buffered by the transport after the handshake.
+type upgradedConn struct {
+	net.Conn
+	rwc io.ReadWriteCloser
+}
+
+func (u *upgradedConn) Read(p []byte) (int, error) {
+	return u.rwc.Read(p)
+}
+
+func (u *upgradedConn) Write(p []byte) (int, error) {
+	return u.rwc.Write(p)
+}
+
+func (u *upgradedConn) Close() error {
+	return u.rwc.Close()
+}
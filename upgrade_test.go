@@ -0,0 +1,119 @@
+package ghttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Upgrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Connection") != "Upgrade" || r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		// sent with the handshake, buffered by the transport
+		_, _ = rw.WriteString("hello\n")
+		_ = rw.Flush()
+
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		_, _ = rw.WriteString(line)
+		_ = rw.Flush()
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL), WithDebug(true), WithDebugWriter(io.Discard), WithNot2xxError(func() error { return &gitlabErr{} }))
+	conn, response, err := c.Upgrade(context.Background(), "/echo", http.Header{"Upgrade": {"echo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Upgrade") != "echo" {
+		t.Errorf("response = %d %v", response.StatusCode, response.Header)
+	}
+	if conn.RemoteAddr().String() != srv.Listener.Addr().String() {
+		t.Errorf("RemoteAddr() = %s, want %s", conn.RemoteAddr(), srv.Listener.Addr())
+	}
+
+	r := bufio.NewReader(conn)
+	if line, err := r.ReadString('\n'); err != nil || line != "hello\n" {
+		t.Fatalf("ReadString() = %q, %v, want hello", line, err)
+	}
+	if _, err = io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := r.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Errorf("ReadString() = %q, %v, want ping", line, err)
+	}
+}
+
+func TestClient_Upgrade_Status(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithEndpoint(srv.URL))
+	if _, _, err := c.Upgrade(context.Background(), "/echo", nil); err == nil {
+		t.Error("Upgrade() without Upgrade header: want error")
+	}
+	_, _, err := c.Upgrade(context.Background(), "/echo", http.Header{"Upgrade": {"echo"}})
+	if code, ok := StatusForErr(err); !ok || code != http.StatusBadRequest {
+		t.Errorf("StatusForErr() = %d, %t, want %d, true", code, ok, http.StatusBadRequest)
+	}
+}
+
+func TestDo_SwitchingProtocols(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		_ = rw.Flush()
+		line, _ := rw.ReadString('\n')
+		_, _ = rw.WriteString(line)
+		_ = rw.Flush()
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithRetry(2, time.Millisecond), WithPerAttemptTimeout(time.Second))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	response, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	// the connection outlives Do and the attempt deadline
+	rwc, ok := response.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("the body of a 101 is a %T, want an io.ReadWriteCloser", response.Body)
+	}
+	if _, err = io.WriteString(rwc, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(rwc).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Errorf("ReadString() = %q, %v, want ping", line, err)
+	}
+}
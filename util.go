@@ -2,8 +2,12 @@ package ghttp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,27 +15,129 @@ import (
 	"github.com/nexuer/ghttp/query"
 )
 
+// ParseMediaType parses the Content-Type header of resp into the lowercased
+// media type and its parameters, e.g. the boundary of a multipart response
+// or the charset of a text response, see mime.ParseMediaType.
+func ParseMediaType(resp *http.Response) (mediaType string, params map[string]string, err error) {
+	return mime.ParseMediaType(resp.Header.Get("Content-Type"))
+}
+
+// DecodeMultipart calls handler for every part of a multipart response, e.g.
+// multipart/mixed or multipart/related, read with the boundary of the
+// Content-Type header. The part is only valid during the call, an error of
+// handler stops reading. The body is closed on return.
+func DecodeMultipart(resp *http.Response, handler func(part *multipart.Part) error) error {
+	defer resp.Body.Close()
+
+	mediaType, params, err := ParseMediaType(resp)
+	if err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return fmt.Errorf("response: not a multipart content type: %s", mediaType)
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("response: multipart without boundary")
+	}
+
+	reader := multipart.NewReader(resp.Body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = handler(part)
+		_ = part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// subContentType returns the subtype of a content type after its first "+",
+// e.g. "json" for "application/vnd.api+json; charset=utf-8", "" without
+// subtype.
 func subContentType(contentType string) string {
-	if contentType == "" {
-		return ""
+	return parseSubtype(contentType).sub
+}
+
+// subtype is the subtype of a content type as used for the codec lookup.
+type subtype struct {
+	// sub is the subtype after its first "+", see subContentType
+	sub string
+	// exact is the lowercased subtype, e.g. "vnd.api+json"
+	exact string
+	// suffix is the lowercased "+suffix" key, e.g. "+json", "" without
+	suffix string
+}
+
+// commonSubtypes are the parsed common content types, read-only once
+// initialized. A content type longer than maxCommonSubtype is not looked up,
+// hashing it costs more than the scan.
+var (
+	commonSubtypes   = make(map[string]subtype)
+	maxCommonSubtype int
+)
+
+func init() {
+	for _, ct := range []string{
+		"application/json",
+		"application/xml",
+		"application/yaml",
+		"application/x-yaml",
+		"application/x-protobuf",
+		"application/octet-stream",
+		"application/x-www-form-urlencoded",
+		"application/problem+json",
+		"application/merge-patch+json",
+		"application/json-patch+json",
+		"multipart/form-data",
+		"text/plain",
+		"text/xml",
+		"text/html",
+		"text/event-stream",
+	} {
+		for _, params := range []string{"", "; charset=utf-8", ";charset=utf-8", "; charset=UTF-8"} {
+			commonSubtypes[ct+params] = scanSubtype(ct + params)
+			maxCommonSubtype = max(maxCommonSubtype, len(ct+params))
+		}
 	}
-	left := strings.Index(contentType, "/")
-	if left == -1 {
-		return ""
+}
+
+// parseSubtype parses the subtype of contentType, from commonSubtypes if
+// cached.
+func parseSubtype(contentType string) subtype {
+	if len(contentType) <= maxCommonSubtype {
+		if st, ok := commonSubtypes[contentType]; ok {
+			return st
+		}
 	}
-	right := strings.Index(contentType, ";")
-	if right == -1 {
-		right = len(contentType)
+	return scanSubtype(contentType)
+}
+
+// scanSubtype parses the subtype of contentType, each delimiter is searched
+// once with strings.IndexByte, which is faster than a byte loop.
+func scanSubtype(contentType string) subtype {
+	end := strings.IndexByte(contentType, ';')
+	if end < 0 {
+		end = len(contentType)
 	}
-	if right < left {
-		return ""
+	slash := strings.IndexByte(contentType[:end], '/')
+	if slash < 0 {
+		return subtype{}
 	}
-	sct := contentType[left+1 : right]
-	left = strings.Index(sct, "+")
-	if left >= 0 {
-		return sct[left+1:]
+
+	sub := contentType[slash+1 : end]
+	st := subtype{sub: sub, exact: strings.ToLower(strings.TrimSpace(sub))}
+	if i := strings.IndexByte(sub, '+'); i >= 0 {
+		st.sub = sub[i+1:]
+		st.suffix = strings.ToLower(strings.TrimSpace(sub[strings.LastIndexByte(sub, '+'):]))
 	}
-	return sct
+	return st
 }
 
 // ProxyURL returns a function that sets a proxy URL for the given HTTP request.
@@ -78,6 +184,61 @@ func ForceHttps(endpoint string) string {
 	return fmt.Sprintf("https://%s", endpoint)
 }
 
+// CloneRequest returns a deep copy of req with a fresh body obtained from
+// req.GetBody, so that both requests can be sent independently.
+//
+// An error is returned if req has a body that cannot be rewound.
+//
+// Example usage:
+//
+//	req, _ := http.NewRequest("POST", "https://example.com", strings.NewReader("data"))
+//	clone, err := CloneRequest(req)
+//	if err != nil {
+//	    log.Fatal("Failed to clone request:", err)
+//	}
+//	// Both req.Body and clone.Body will read "data"
+func CloneRequest(req *http.Request) (*http.Request, error) {
+	if req == nil {
+		return nil, errors.New("http: nil http request")
+	}
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request: body is not rewindable, GetBody is nil")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+// Pathf formats a request path like fmt.Sprintf, escaping the string and
+// fmt.Stringer args with url.PathEscape, so that a value containing a slash
+// stays a single path segment:
+//
+//	client.Invoke(ctx, http.MethodGet, ghttp.Pathf("projects/%s", "group/project"), nil, &reply)
+//	// GET projects/group%2Fproject
+//
+// Other args, e.g. integers, are formatted as is.
+func Pathf(format string, args ...any) string {
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			escaped[i] = url.PathEscape(v)
+		case fmt.Stringer:
+			escaped[i] = url.PathEscape(v.String())
+		default:
+			escaped[i] = arg
+		}
+	}
+	return fmt.Sprintf(format, escaped...)
+}
+
 func not2xxCode(code int) bool {
 	return code < 200 || code > 299
 }
@@ -135,6 +296,15 @@ func joinPath(endpoint, path string) string {
 //
 //	// The request URL will now include the query parameters encoded as `?name=example&value=42`
 func SetQuery(req *http.Request, q any) error {
+	return setQuery(req, q, url.Values.Encode)
+}
+
+// SetQueryPercent is like SetQuery but escapes spaces as "%20" instead of "+".
+func SetQueryPercent(req *http.Request, q any) error {
+	return setQuery(req, q, query.EncodePercent)
+}
+
+func setQuery(req *http.Request, q any, encode func(url.Values) string) error {
 	if q == nil {
 		return nil
 	}
@@ -142,7 +312,7 @@ func SetQuery(req *http.Request, q any) error {
 	if err != nil {
 		return err
 	}
-	queryStr := values.Encode()
+	queryStr := encode(values)
 	if queryStr == "" {
 		return nil
 	}
@@ -170,6 +340,9 @@ func SetQuery(req *http.Request, q any) error {
 //	    log.Fatal("Failed to bind response body:", err)
 //	}
 //	// The 'userResponse' struct will now be populated with the decoded response data.
+//
+// Reading the body is aborted when the context of resp.Request is done, even
+// if the connection stalls after the headers.
 func BindResponseBody(resp *http.Response, target any) error {
 	if target == nil {
 		return nil
@@ -186,13 +359,34 @@ func BindResponseBody(resp *http.Response, target any) error {
 	}
 
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	var ctx context.Context
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+	body, err := readAll(ctx, resp.Body)
 	if err != nil {
 		return err
 	}
 	return codec.Unmarshal(body, target)
 }
 
+// readAll reads body until EOF, closing it to interrupt a blocked read when
+// ctx is done.
+func readAll(ctx context.Context, body io.ReadCloser) ([]byte, error) {
+	if ctx == nil || ctx.Done() == nil {
+		return io.ReadAll(body)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = body.Close()
+	})
+	data, err := io.ReadAll(body)
+	if !stop() {
+		// the body was closed by ctx
+		return nil, ctx.Err()
+	}
+	return data, err
+}
+
 // EncodeRequestBody encodes the provided body content based on the Content-Type of the
 // given HTTP request, and sets the encoded body in the request.
 //
@@ -289,6 +483,9 @@ func SetRequestBody(req *http.Request, body io.Reader) error {
 			return io.NopCloser(&r), nil
 		}
 	default:
+		// The length is unknown, the body is sent with chunked transfer
+		// encoding and, without GetBody, cannot be rewound for a retry.
+		//
 		// This is where we'd set it to -1 (at least
 		// if body != NoBody) to mean unknown, but
 		// that broke people during the Go 1.8 testing
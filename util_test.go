@@ -1,6 +1,18 @@
 package ghttp
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestSubContentType(t *testing.T) {
 	tests := []struct {
@@ -43,19 +55,325 @@ func TestSubContentType(t *testing.T) {
 			contentType: "text/plain; charset=utf-8",
 			want:        "plain",
 		},
+		{
+			contentType: "application/a+b+json",
+			want:        "b+json",
+		},
+		{
+			contentType: "json; a=b/c",
+			want:        "",
+		},
+		{
+			contentType: "",
+			want:        "",
+		},
 	}
 
 	for _, v := range tests {
 		target := subContentType(v.contentType)
 		if target != v.want {
-			t.Logf("SubContentType() failed: target=%s want=%s", target, v.want)
+			t.Errorf("SubContentType() failed: target=%s want=%s", target, v.want)
+		}
+	}
+}
+
+func TestParseSubtype(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        subtype
+	}{
+		{"application/json", subtype{sub: "json", exact: "json"}},
+		{"Application/JSON; charset=utf-8", subtype{sub: "JSON", exact: "json"}},
+		{"application/vnd.foo+json", subtype{sub: "json", exact: "vnd.foo+json", suffix: "+json"}},
+		{"application/a+b+JSON ; x=y", subtype{sub: "b+JSON ", exact: "a+b+json", suffix: "+json"}},
+		{"application/*+json", subtype{sub: "json", exact: "*+json", suffix: "+json"}},
+		{"a+b/json", subtype{sub: "json", exact: "json"}},
+		{"text", subtype{}},
+	}
+	for _, tt := range tests {
+		if got := parseSubtype(tt.contentType); got != tt.want {
+			t.Errorf("parseSubtype(%q) = %+v, want %+v", tt.contentType, got, tt.want)
+		}
+	}
+
+	// the cache holds the result of the scan
+	for ct, st := range commonSubtypes {
+		if got := scanSubtype(ct); got != st {
+			t.Errorf("scanSubtype(%q) = %+v, cached %+v", ct, got, st)
 		}
 	}
 }
 
 func BenchmarkSubContentType(b *testing.B) {
+	for _, ct := range []string{
+		"application/json; charset=utf-8",
+		"application/vnd.docker.distribution.manifest.v2+json; charset=utf-8",
+	} {
+		b.Run(ct, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				subContentType(ct)
+			}
+		})
+	}
+}
+
+func BenchmarkCodecLookup(b *testing.B) {
+	for _, ct := range []string{
+		"application/json; charset=utf-8",
+		"application/vnd.docker.distribution.manifest.v2+json; charset=utf-8",
+	} {
+		b.Run(ct, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				defaultContentType.get(ct)
+			}
+		})
+	}
+}
+
+func TestCloneRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/api", strings.NewReader("request body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Test", "1")
+
+	clone, err := CloneRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.Header.Set("X-Test", "2")
+	if got := req.Header.Get("X-Test"); got != "1" {
+		t.Errorf("original header X-Test = %q, want %q", got, "1")
+	}
+
+	for _, r := range []*http.Request{req, clone} {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "request body" {
+			t.Errorf("body = %q, want %q", body, "request body")
+		}
+	}
+
+	// not rewindable
+	req, err = http.NewRequest(http.MethodPost, "https://example.com/api", io.NopCloser(strings.NewReader("stream")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CloneRequest(req); err == nil {
+		t.Errorf("CloneRequest() error = nil, want error for non-rewindable body")
+	}
+}
+
+func TestSetQueryPercent(t *testing.T) {
+	q := map[string]string{"q": "hello world"}
+	tests := []struct {
+		set  func(*http.Request, any) error
+		want string
+	}{
+		{set: SetQuery, want: "a=1&q=hello+world"},
+		{set: SetQueryPercent, want: "a=1&q=hello%20world"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/api?a=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tt.set(req, q); err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.RawQuery != tt.want {
+			t.Errorf("RawQuery = %q, want %q", req.URL.RawQuery, tt.want)
+		}
+	}
+}
+
+func TestBindResponseBody_ContextCanceled(t *testing.T) {
+	// the server sent the headers, then the connection stalls
+	body, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       body,
+		Request:    req,
+	}
+	go func() {
+		_, _ = w.Write([]byte(`{"name":`))
+	}()
+
+	start := time.Now()
+	var reply map[string]any
+	err := BindResponseBody(resp, &reply)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BindResponseBody() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("BindResponseBody() took %s, want it to abort at the deadline", elapsed)
+	}
+}
+
+func TestInvoke_StalledBody(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"name":`))
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := NewClient(WithEndpoint(srv.URL), WithTimeout(100*time.Millisecond))
+	start := time.Now()
+	var reply map[string]any
+	if _, err := c.Invoke(context.Background(), http.MethodGet, "/", nil, &reply); err == nil {
+		t.Fatal("Invoke() error = nil, want the deadline to abort the read")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Invoke() took %s, want it to abort at the deadline", elapsed)
+	}
+}
 
-	for i := 0; i < b.N; i++ {
-		subContentType("application/vnd.docker.distribution.manifest.v2+json; charset=utf-8")
+func TestBindResponseBody_Binary(t *testing.T) {
+	data := []byte{0x00, 0xff, 0x7b, 0x22}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	var reply []byte
+	_, err := NewClient(WithEndpoint(srv.URL), WithStrictCodec(true)).
+		Invoke(context.Background(), http.MethodGet, "/file", nil, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply, data) {
+		t.Errorf("reply = %v, want %v", reply, data)
+	}
+}
+
+func TestParseMediaType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		mediaType   string
+		params      map[string]string
+		wantErr     bool
+	}{
+		{
+			contentType: `multipart/mixed; boundary="simple boundary"`,
+			mediaType:   "multipart/mixed",
+			params:      map[string]string{"boundary": "simple boundary"},
+		},
+		{
+			contentType: "Text/HTML; Charset=ISO-8859-1",
+			mediaType:   "text/html",
+			params:      map[string]string{"charset": "ISO-8859-1"},
+		},
+		{
+			contentType: "application/json",
+			mediaType:   "application/json",
+			params:      map[string]string{},
+		},
+		{contentType: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.contentType != "" {
+			resp.Header.Set("Content-Type", tt.contentType)
+		}
+		mediaType, params, err := ParseMediaType(resp)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMediaType(%q) error = %v, wantErr %t", tt.contentType, err, tt.wantErr)
+			continue
+		}
+		if mediaType != tt.mediaType || (!tt.wantErr && !reflect.DeepEqual(params, tt.params)) {
+			t.Errorf("ParseMediaType(%q) = %q, %v, want %q, %v", tt.contentType, mediaType, params, tt.mediaType, tt.params)
+		}
+	}
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `multipart/mixed; boundary="sep"`)
+		_, _ = io.WriteString(w, "--sep\r\n"+
+			"Content-Type: application/json\r\n\r\n"+
+			`{"name":"acme"}`+"\r\n"+
+			"--sep\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Id: <note>\r\n\r\n"+
+			"hello\r\n"+
+			"--sep--\r\n")
+	}))
+	defer srv.Close()
+
+	response, err := NewClient(WithEndpoint(srv.URL)).Invoke(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type part struct {
+		contentType string
+		body        string
+	}
+	var parts []part
+	err = DecodeMultipart(response, func(p *multipart.Part) error {
+		body, err := io.ReadAll(p)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, part{contentType: p.Header.Get("Content-Type"), body: string(body)})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []part{
+		{contentType: "application/json", body: `{"name":"acme"}`},
+		{contentType: "text/plain", body: "hello"},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("parts = %+v, want %+v", parts, want)
+	}
+
+	// not multipart
+	resp := &http.Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(strings.NewReader("{}"))}
+	if err = DecodeMultipart(resp, func(*multipart.Part) error { return nil }); err == nil {
+		t.Error("DecodeMultipart() of application/json: want error")
+	}
+}
+
+func TestPathf(t *testing.T) {
+	var gotURI string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.RequestURI
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: Pathf("projects/%s", "group/proj"), want: "/projects/group%2Fproj"},
+		{path: Pathf("projects/%s/issues/%d", "my group/proj", 7), want: "/projects/my%20group%2Fproj/issues/7"},
+		{path: Pathf("/files/%s?ref=%s", "a b/c.txt", "main"), want: "/files/a%20b%2Fc.txt?ref=main"},
+	}
+	c := NewClient(WithEndpoint(srv.URL))
+	for _, tt := range tests {
+		if _, err := c.Invoke(context.Background(), http.MethodGet, tt.path, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if gotURI != tt.want {
+			t.Errorf("RequestURI = %q, want %q", gotURI, tt.want)
+		}
 	}
 }
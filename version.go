@@ -0,0 +1,12 @@
+package ghttp
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version is the version of ghttp.
+const Version = "0.1.0"
+
+// defaultUserAgent is sent when WithUserAgent is not set, e.g. "ghttp/0.1.0 (go1.21.0)".
+var defaultUserAgent = fmt.Sprintf("ghttp/%s (%s)", Version, runtime.Version())